@@ -7,8 +7,6 @@ package dry
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
@@ -59,37 +57,187 @@ func BytesDecodeHex(hexStr string) string {
 	return string(result)
 }
 
-func BytesDeflate(uncompressed []byte) (compressed []byte) {
+// BytesDeflate compresses uncompressed with the first optional
+// level of compress/flate, default is flate.BestCompression.
+// Invalid levels also use the default, see BytesDeflateErr for an error instead.
+func BytesDeflate(uncompressed []byte, level ...int) (compressed []byte) {
+	l := validCompressionLevel(level)
 	var buf bytes.Buffer
-	writer := Deflate.GetWriter(&buf)
+	writer := Deflate.GetWriterLevel(&buf, l)
 	writer.Write(uncompressed)
-	Deflate.ReturnWriter(writer)
+	Deflate.ReturnWriterLevel(writer, l)
 	return buf.Bytes()
 }
 
 func BytesInflate(compressed []byte) (uncompressed []byte) {
-	reader := flate.NewReader(bytes.NewBuffer(compressed))
+	reader := Deflate.GetReader(bytes.NewReader(compressed))
+	defer Deflate.ReturnReader(reader)
 	result, _ := ioutil.ReadAll(reader)
 	return result
 }
 
-func BytesGzip(uncompressed []byte) (compressed []byte) {
+// BytesGzip compresses uncompressed with the first optional
+// level of compress/gzip, default is gzip.BestCompression.
+// Invalid levels also use the default, see BytesGzipErr for an error instead.
+func BytesGzip(uncompressed []byte, level ...int) (compressed []byte) {
+	l := validCompressionLevel(level)
 	var buf bytes.Buffer
-	writer := Gzip.GetWriter(&buf)
+	writer := Gzip.GetWriterLevel(&buf, l)
 	writer.Write(uncompressed)
-	Gzip.ReturnWriter(writer)
+	Gzip.ReturnWriterLevel(writer, l)
 	return buf.Bytes()
 }
 
 func BytesUnGzip(compressed []byte) (uncompressed []byte) {
-	reader, err := gzip.NewReader(bytes.NewBuffer(compressed))
+	reader, err := Gzip.GetReader(bytes.NewReader(compressed))
 	if err != nil {
 		return nil
 	}
+	defer Gzip.ReturnReader(reader)
 	result, _ := ioutil.ReadAll(reader)
 	return result
 }
 
+// BytesDeflateErr is like BytesDeflate, but returns errors,
+// e.g. for an invalid level.
+func BytesDeflateErr(uncompressed []byte, level ...int) (compressed []byte, err error) {
+	l := compressionLevel(level)
+	if err = checkCompressionLevel(l); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer := Deflate.GetWriterLevel(&buf, l)
+	_, err = writer.Write(uncompressed)
+	if err == nil {
+		err = writer.Close()
+	}
+	Deflate.ReturnWriterLevel(writer, l)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// BytesInflateErr is like BytesInflate, but returns an error for corrupt
+// or truncated input, and ErrDecompressLimit if the result would be
+// larger than the MaxSize of the first optional options.
+func BytesInflateErr(compressed []byte, options ...DecompressOptions) (uncompressed []byte, err error) {
+	reader := Deflate.GetReader(bytes.NewReader(compressed))
+	defer Deflate.ReturnReader(reader)
+	return decompressAll(reader, options)
+}
+
+// BytesGzipErr is like BytesGzip, but returns errors,
+// e.g. for an invalid level.
+func BytesGzipErr(uncompressed []byte, level ...int) (compressed []byte, err error) {
+	l := compressionLevel(level)
+	if err = checkCompressionLevel(l); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer := Gzip.GetWriterLevel(&buf, l)
+	_, err = writer.Write(uncompressed)
+	if err == nil {
+		err = writer.Close()
+	}
+	Gzip.ReturnWriterLevel(writer, l)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// BytesUnGzipErr is like BytesUnGzip, but returns an error for corrupt
+// or truncated input, and ErrDecompressLimit if the result would be
+// larger than the MaxSize of the first optional options.
+func BytesUnGzipErr(compressed []byte, options ...DecompressOptions) (uncompressed []byte, err error) {
+	reader, err := Gzip.GetReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer Gzip.ReturnReader(reader)
+	return decompressAll(reader, options)
+}
+
+// BytesZlib compresses uncompressed with the first optional
+// level of compress/zlib, default is zlib.BestCompression.
+// Invalid levels also use the default, see BytesZlibErr for an error instead.
+func BytesZlib(uncompressed []byte, level ...int) (compressed []byte) {
+	l := validCompressionLevel(level)
+	var buf bytes.Buffer
+	writer := Zlib.GetWriterLevel(&buf, l)
+	writer.Write(uncompressed)
+	Zlib.ReturnWriterLevel(writer, l)
+	return buf.Bytes()
+}
+
+func BytesUnZlib(compressed []byte) (uncompressed []byte) {
+	reader, err := Zlib.GetReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil
+	}
+	defer Zlib.ReturnReader(reader)
+	result, _ := ioutil.ReadAll(reader)
+	return result
+}
+
+// BytesZlibErr is like BytesZlib, but returns errors,
+// e.g. for an invalid level.
+func BytesZlibErr(uncompressed []byte, level ...int) (compressed []byte, err error) {
+	l := compressionLevel(level)
+	if err = checkCompressionLevel(l); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer := Zlib.GetWriterLevel(&buf, l)
+	_, err = writer.Write(uncompressed)
+	if err == nil {
+		err = writer.Close()
+	}
+	Zlib.ReturnWriterLevel(writer, l)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// BytesUnZlibErr is like BytesUnZlib, but returns an error for corrupt
+// or truncated input, and ErrDecompressLimit if the result would be
+// larger than the MaxSize of the first optional options.
+func BytesUnZlibErr(compressed []byte, options ...DecompressOptions) (uncompressed []byte, err error) {
+	reader, err := Zlib.GetReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer Zlib.ReturnReader(reader)
+	return decompressAll(reader, options)
+}
+
+// BytesLZW compresses uncompressed with LZW, see LZWPool.
+func BytesLZW(uncompressed []byte) (compressed []byte) {
+	var buf bytes.Buffer
+	writer := LZW.GetWriter(&buf)
+	writer.Write(uncompressed)
+	LZW.ReturnWriter(writer)
+	return buf.Bytes()
+}
+
+func BytesUnLZW(compressed []byte) (uncompressed []byte) {
+	reader := LZW.GetReader(bytes.NewReader(compressed))
+	defer LZW.ReturnReader(reader)
+	result, _ := ioutil.ReadAll(reader)
+	return result
+}
+
+// BytesUnLZWErr is like BytesUnLZW, but returns an error for corrupt
+// or truncated input, and ErrDecompressLimit if the result would be
+// larger than the MaxSize of the first optional options.
+func BytesUnLZWErr(compressed []byte, options ...DecompressOptions) (uncompressed []byte, err error) {
+	reader := LZW.GetReader(bytes.NewReader(compressed))
+	defer LZW.ReturnReader(reader)
+	return decompressAll(reader, options)
+}
+
 // BytesHead returns at most numLines from data starting at the beginning.
 // A slice of the remaining data is returned as rest.
 // \n is used to detect line ends, a preceding \r will be stripped away.
@@ -7,6 +7,8 @@ package dry
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"io"
 	"reflect"
 	"strings"
@@ -123,11 +125,15 @@ func testCompressDecompress(t *testing.T,
 }
 
 func Test_BytesDeflateInflate(t *testing.T) {
-	testCompressDecompress(t, BytesDeflate, BytesInflate)
+	testCompressDecompress(t, func(data []byte) []byte { return BytesDeflate(data) }, BytesInflate)
+	testCompressDecompress(t, func(data []byte) []byte { return BytesDeflate(data, flate.HuffmanOnly) }, BytesInflate)
+	testCompressDecompress(t, func(data []byte) []byte { return BytesDeflate(data, 42) }, BytesInflate)
 }
 
 func Test_BytesGzipUnGzip(t *testing.T) {
-	testCompressDecompress(t, BytesGzip, BytesUnGzip)
+	testCompressDecompress(t, func(data []byte) []byte { return BytesGzip(data) }, BytesUnGzip)
+	testCompressDecompress(t, func(data []byte) []byte { return BytesGzip(data, gzip.BestSpeed) }, BytesUnGzip)
+	testCompressDecompress(t, func(data []byte) []byte { return BytesGzip(data, -3) }, BytesUnGzip)
 }
 
 func bytesHeadTailTestHelper(
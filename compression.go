@@ -8,31 +8,117 @@ package dry
 import (
 	"compress/flate"
 	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 	"sync"
 )
 
 var (
 	Deflate DeflatePool
 	Gzip    GzipPool
+	Zlib    ZlibPool
+	LZW     LZWPool
 )
 
-// DeflatePool manages a pool of flate.Writer
+// ErrDecompressLimit is returned when decompressed data
+// exceeds DecompressOptions.MaxSize.
+var ErrDecompressLimit = errors.New("decompressed size exceeds limit")
+
+// DecompressOptions limits the decompression of untrusted data.
+type DecompressOptions struct {
+	// MaxSize is the maximum decompressed size in bytes,
+	// zero means no limit.
+	MaxSize int64
+}
+
+// decompressAll reads reader completely, respecting the first optional options.
+func decompressAll(reader io.Reader, options []DecompressOptions) ([]byte, error) {
+	var maxSize int64
+	if len(options) > 0 {
+		maxSize = options[0].MaxSize
+	}
+	if maxSize <= 0 {
+		return ioutil.ReadAll(reader)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes", ErrDecompressLimit, maxSize)
+	}
+	return data, nil
+}
+
+// checkCompressionLevel returns an error for levels not supported by compress/flate.
+func checkCompressionLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("invalid compression level %d", level)
+	}
+	return nil
+}
+
+// compressionLevels is the number of compression levels
+// from flate.HuffmanOnly to flate.BestCompression.
+const compressionLevels = flate.BestCompression - flate.HuffmanOnly + 1
+
+// compressionLevelIndex returns the pool index of level,
+// which can be any of the level constants of compress/flate.
+func compressionLevelIndex(level int) int {
+	if err := checkCompressionLevel(level); err != nil {
+		panic(err)
+	}
+	return level - flate.HuffmanOnly
+}
+
+// compressionLevel returns the first optional level, or flate.BestCompression.
+func compressionLevel(level []int) int {
+	if len(level) > 0 {
+		return level[0]
+	}
+	return flate.BestCompression
+}
+
+// validCompressionLevel is like compressionLevel,
+// but returns flate.BestCompression for invalid levels.
+func validCompressionLevel(level []int) int {
+	l := compressionLevel(level)
+	if checkCompressionLevel(l) != nil {
+		return flate.BestCompression
+	}
+	return l
+}
+
+// DeflatePool manages a pool of flate.Writer per compression level
+// and a pool of flate readers.
 // flate.NewWriter allocates a lot of memory, so if flate.Writer
 // are needed frequently, it's more efficient to use a pool of them.
 // The pool uses sync.Pool internally.
 type DeflatePool struct {
-	pool sync.Pool
+	pools   [compressionLevels]sync.Pool
+	readers sync.Pool
 }
 
 // GetWriter returns flate.Writer from the pool, or creates a new one
 // with flate.BestCompression if the pool is empty.
 func (pool *DeflatePool) GetWriter(dst io.Writer) (writer *flate.Writer) {
-	if w := pool.pool.Get(); w != nil {
+	return pool.GetWriterLevel(dst, flate.BestCompression)
+}
+
+// GetWriterLevel returns flate.Writer with the compression level
+// from the pool, or creates a new one if the pool is empty.
+// The writer must be returned with ReturnWriterLevel and the same level.
+func (pool *DeflatePool) GetWriterLevel(dst io.Writer, level int) (writer *flate.Writer) {
+	if w := pool.pools[compressionLevelIndex(level)].Get(); w != nil {
 		writer = w.(*flate.Writer)
 		writer.Reset(dst)
 	} else {
-		writer, _ = flate.NewWriter(dst, flate.BestCompression)
+		writer, _ = flate.NewWriter(dst, level)
 	}
 	return writer
 }
@@ -42,24 +128,57 @@ func (pool *DeflatePool) GetWriter(dst io.Writer) (writer *flate.Writer) {
 // Don't close the writer, Flush will be called before returning
 // it to the pool.
 func (pool *DeflatePool) ReturnWriter(writer *flate.Writer) {
+	pool.ReturnWriterLevel(writer, flate.BestCompression)
+}
+
+// ReturnWriterLevel returns a flate.Writer from GetWriterLevel
+// to the pool of level. Don't close the writer, it is closed here.
+func (pool *DeflatePool) ReturnWriterLevel(writer *flate.Writer, level int) {
 	writer.Close()
-	pool.pool.Put(writer)
+	pool.pools[compressionLevelIndex(level)].Put(writer)
+}
+
+// GetReader returns a flate reader of src from the pool,
+// or creates a new one if the pool is empty.
+func (pool *DeflatePool) GetReader(src io.Reader) (reader io.ReadCloser) {
+	if r := pool.readers.Get(); r != nil {
+		reader = r.(io.ReadCloser)
+		reader.(flate.Resetter).Reset(src, nil)
+		return reader
+	}
+	return flate.NewReader(src)
+}
+
+// ReturnReader returns a reader from GetReader to the pool.
+// Don't close the reader, it is closed here.
+func (pool *DeflatePool) ReturnReader(reader io.ReadCloser) {
+	reader.Close()
+	pool.readers.Put(reader)
 }
 
-// GzipPool manages a pool of gzip.Writer.
+// GzipPool manages a pool of gzip.Writer per compression level
+// and a pool of gzip.Reader.
 // The pool uses sync.Pool internally.
 type GzipPool struct {
-	pool sync.Pool
+	pools   [compressionLevels]sync.Pool
+	readers sync.Pool
 }
 
 // GetWriter returns gzip.Writer from the pool, or creates a new one
 // with gzip.BestCompression if the pool is empty.
 func (pool *GzipPool) GetWriter(dst io.Writer) (writer *gzip.Writer) {
-	if w := pool.pool.Get(); w != nil {
+	return pool.GetWriterLevel(dst, gzip.BestCompression)
+}
+
+// GetWriterLevel returns gzip.Writer with the compression level
+// from the pool, or creates a new one if the pool is empty.
+// The writer must be returned with ReturnWriterLevel and the same level.
+func (pool *GzipPool) GetWriterLevel(dst io.Writer, level int) (writer *gzip.Writer) {
+	if w := pool.pools[compressionLevelIndex(level)].Get(); w != nil {
 		writer = w.(*gzip.Writer)
 		writer.Reset(dst)
 	} else {
-		writer, _ = gzip.NewWriterLevel(dst, gzip.BestCompression)
+		writer, _ = gzip.NewWriterLevel(dst, level)
 	}
 	return writer
 }
@@ -69,6 +188,314 @@ func (pool *GzipPool) GetWriter(dst io.Writer) (writer *gzip.Writer) {
 // Don't close the writer, Flush will be called before returning
 // it to the pool.
 func (pool *GzipPool) ReturnWriter(writer *gzip.Writer) {
+	pool.ReturnWriterLevel(writer, gzip.BestCompression)
+}
+
+// ReturnWriterLevel returns a gzip.Writer from GetWriterLevel
+// to the pool of level. Don't close the writer, it is closed here.
+func (pool *GzipPool) ReturnWriterLevel(writer *gzip.Writer, level int) {
 	writer.Close()
-	pool.pool.Put(writer)
+	pool.pools[compressionLevelIndex(level)].Put(writer)
+}
+
+// GetReader returns a gzip.Reader of src from the pool,
+// or creates a new one if the pool is empty.
+// An error is returned if src doesn't start with a valid gzip header.
+func (pool *GzipPool) GetReader(src io.Reader) (*gzip.Reader, error) {
+	if r := pool.readers.Get(); r != nil {
+		reader := r.(*gzip.Reader)
+		if err := reader.Reset(src); err != nil {
+			pool.readers.Put(reader)
+			return nil, err
+		}
+		return reader, nil
+	}
+	return gzip.NewReader(src)
+}
+
+// ReturnReader returns a reader from GetReader to the pool.
+// Don't close the reader, it is closed here.
+func (pool *GzipPool) ReturnReader(reader *gzip.Reader) {
+	reader.Close()
+	pool.readers.Put(reader)
+}
+
+// ZlibPool manages a pool of zlib.Writer per compression level
+// and a pool of zlib readers.
+// The pool uses sync.Pool internally.
+type ZlibPool struct {
+	pools   [compressionLevels]sync.Pool
+	readers sync.Pool
+}
+
+// GetWriter returns zlib.Writer from the pool, or creates a new one
+// with zlib.BestCompression if the pool is empty.
+func (pool *ZlibPool) GetWriter(dst io.Writer) (writer *zlib.Writer) {
+	return pool.GetWriterLevel(dst, zlib.BestCompression)
+}
+
+// GetWriterLevel returns zlib.Writer with the compression level
+// from the pool, or creates a new one if the pool is empty.
+// The writer must be returned with ReturnWriterLevel and the same level.
+func (pool *ZlibPool) GetWriterLevel(dst io.Writer, level int) (writer *zlib.Writer) {
+	if w := pool.pools[compressionLevelIndex(level)].Get(); w != nil {
+		writer = w.(*zlib.Writer)
+		writer.Reset(dst)
+	} else {
+		writer, _ = zlib.NewWriterLevel(dst, level)
+	}
+	return writer
+}
+
+// ReturnWriter returns a zlib.Writer from GetWriter to the pool.
+// Don't close the writer, it is closed here.
+func (pool *ZlibPool) ReturnWriter(writer *zlib.Writer) {
+	pool.ReturnWriterLevel(writer, zlib.BestCompression)
+}
+
+// ReturnWriterLevel returns a zlib.Writer from GetWriterLevel
+// to the pool of level. Don't close the writer, it is closed here.
+func (pool *ZlibPool) ReturnWriterLevel(writer *zlib.Writer, level int) {
+	// zlib.Writer writes its checksum again if closed twice,
+	// Flush fails if it is already closed
+	if writer.Flush() == nil {
+		writer.Close()
+	}
+	pool.pools[compressionLevelIndex(level)].Put(writer)
+}
+
+// GetReader returns a zlib reader of src from the pool,
+// or creates a new one if the pool is empty.
+// An error is returned if src doesn't start with a valid zlib header.
+func (pool *ZlibPool) GetReader(src io.Reader) (io.ReadCloser, error) {
+	if r := pool.readers.Get(); r != nil {
+		reader := r.(io.ReadCloser)
+		if err := reader.(zlib.Resetter).Reset(src, nil); err != nil {
+			pool.readers.Put(reader)
+			return nil, err
+		}
+		return reader, nil
+	}
+	return zlib.NewReader(src)
+}
+
+// ReturnReader returns a reader from GetReader to the pool.
+// Don't close the reader, it is closed here.
+func (pool *ZlibPool) ReturnReader(reader io.ReadCloser) {
+	reader.Close()
+	pool.readers.Put(reader)
+}
+
+// LZWPool manages pools of LZW writers and readers using least
+// significant bit first order and 8 bit literals, like FileLZW.
+// The pool uses sync.Pool internally.
+type LZWPool struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// GetWriter returns lzw.Writer from the pool,
+// or creates a new one if the pool is empty.
+func (pool *LZWPool) GetWriter(dst io.Writer) (writer *lzw.Writer) {
+	if w := pool.writers.Get(); w != nil {
+		writer = w.(*lzw.Writer)
+		writer.Reset(dst, lzw.LSB, 8)
+		return writer
+	}
+	return lzw.NewWriter(dst, lzw.LSB, 8).(*lzw.Writer)
+}
+
+// ReturnWriter returns a writer from GetWriter to the pool.
+// Don't close the writer, it is closed here.
+func (pool *LZWPool) ReturnWriter(writer *lzw.Writer) {
+	writer.Close()
+	pool.writers.Put(writer)
+}
+
+// GetReader returns lzw.Reader of src from the pool,
+// or creates a new one if the pool is empty.
+func (pool *LZWPool) GetReader(src io.Reader) (reader *lzw.Reader) {
+	if r := pool.readers.Get(); r != nil {
+		reader = r.(*lzw.Reader)
+		reader.Reset(src, lzw.LSB, 8)
+		return reader
+	}
+	return lzw.NewReader(src, lzw.LSB, 8).(*lzw.Reader)
+}
+
+// ReturnReader returns a reader from GetReader to the pool.
+// Don't close the reader, it is closed here.
+func (pool *LZWPool) ReturnReader(reader *lzw.Reader) {
+	reader.Close()
+	pool.readers.Put(reader)
+}
+
+// Codec is a compression format that can be registered with RegisterCodec,
+// so HTTPCompressHandler can negotiate it. Codecs also implementing
+// CodecFileFormat are detected and written by the file functions,
+// see FileCompressionOf and FileSetCompressed.
+// Gzip and deflate are registered by default.
+// Example for adding brotli with github.com/andybalholm/brotli:
+//
+//	type brotliCodec struct{}
+//
+//	func (brotliCodec) Name() string { return "br" }
+//	func (brotliCodec) NewWriter(dst io.Writer) (io.WriteCloser, error) {
+//		return brotli.NewWriter(dst), nil
+//	}
+//	func (brotliCodec) NewReader(src io.Reader) (io.ReadCloser, error) {
+//		return ioutil.NopCloser(brotli.NewReader(src)), nil
+//	}
+//	func (brotliCodec) Extensions() []string { return []string{".br"} }
+//	func (brotliCodec) Magic() []byte        { return nil }
+//
+//	func init() {
+//		dry.RegisterCodec(brotliCodec{})
+//	}
+type Codec interface {
+	// Name is the HTTP content coding, like "gzip" or "br".
+	Name() string
+	// NewWriter returns a writer compressing to dst,
+	// data is completely written to dst on Close.
+	// If the writer has a Flush method, it is used
+	// to flush streamed HTTP responses.
+	NewWriter(dst io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing src.
+	// Closing it must not close src.
+	NewReader(src io.Reader) (io.ReadCloser, error)
+}
+
+// CodecFileFormat can be implemented by a Codec to be
+// used for files with certain extensions or magic bytes.
+type CodecFileFormat interface {
+	// Extensions are lowercase file extensions like ".br".
+	Extensions() []string
+	// Magic are the first bytes of every stream,
+	// or nil if the format has none.
+	Magic() []byte
+}
+
+var codecRegistry = struct {
+	sync.RWMutex
+	codecs []Codec
+}{
+	codecs: []Codec{gzipCodec{}, deflateCodec{}},
+}
+
+// RegisterCodec adds codec, or replaces the registered codec with the same name.
+func RegisterCodec(codec Codec) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	for i, c := range codecRegistry.codecs {
+		if strings.EqualFold(c.Name(), codec.Name()) {
+			codecRegistry.codecs[i] = codec
+			return
+		}
+	}
+	codecRegistry.codecs = append(codecRegistry.codecs, codec)
+}
+
+// CodecByName returns the registered codec with the case-insensitive name, or nil.
+func CodecByName(name string) Codec {
+	_, codec := codecIndex(name)
+	return codec
+}
+
+// Codecs returns all registered codecs in order of registration.
+func Codecs() []Codec {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	return append([]Codec(nil), codecRegistry.codecs...)
+}
+
+func codecIndex(name string) (int, Codec) {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	for i, codec := range codecRegistry.codecs {
+		if strings.EqualFold(codec.Name(), name) {
+			return i, codec
+		}
+	}
+	return -1, nil
+}
+
+func codecAt(index int) Codec {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	if index < 0 || index >= len(codecRegistry.codecs) {
+		return nil
+	}
+	return codecRegistry.codecs[index]
+}
+
+// codecWriter returns a pooled writer to its pool on Close.
+type codecWriter struct {
+	io.WriteCloser
+	release func()
+	closed  bool
+}
+
+func (w *codecWriter) Flush() error {
+	if flusher, ok := w.WriteCloser.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+func (w *codecWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.WriteCloser.Close()
+	w.release()
+	return err
+}
+
+// codecReader returns a pooled reader to its pool on Close.
+type codecReader struct {
+	io.Reader
+	release func()
+	closed  bool
+}
+
+func (r *codecReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.release()
+	}
+	return nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) NewWriter(dst io.Writer) (io.WriteCloser, error) {
+	writer := Gzip.GetWriter(dst)
+	return &codecWriter{WriteCloser: writer, release: func() { Gzip.ReturnWriter(writer) }}, nil
+}
+
+func (gzipCodec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	reader, err := Gzip.GetReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return &codecReader{Reader: reader, release: func() { Gzip.ReturnReader(reader) }}, nil
+}
+
+// deflateCodec writes raw deflate streams, which all browsers
+// accept for the "deflate" content coding.
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+
+func (deflateCodec) NewWriter(dst io.Writer) (io.WriteCloser, error) {
+	writer := Deflate.GetWriter(dst)
+	return &codecWriter{WriteCloser: writer, release: func() { Deflate.ReturnWriter(writer) }}, nil
+}
+
+func (deflateCodec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	reader := Deflate.GetReader(src)
+	return &codecReader{Reader: reader, release: func() { Deflate.ReturnReader(reader) }}, nil
 }
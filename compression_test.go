@@ -0,0 +1,276 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionPoolLevels(t *testing.T) {
+	data := []byte(strings.Repeat("compressible data ", 1000))
+	var sizes []int
+	for _, level := range []int{flate.HuffmanOnly, flate.BestSpeed, flate.BestCompression} {
+		// twice to use a pooled writer
+		for i := 0; i < 2; i++ {
+			compressed := BytesDeflate(data, level)
+			require.Equal(t, data, BytesInflate(compressed))
+			if i == 0 {
+				sizes = append(sizes, len(compressed))
+			}
+		}
+	}
+	require.True(t, sizes[0] > sizes[2], "%v", sizes)
+
+	require.Panics(t, func() { Deflate.GetWriterLevel(ioutil.Discard, 10) })
+}
+
+func TestCompressionPoolReaders(t *testing.T) {
+	data := []byte("hello reader pool")
+
+	for i := 0; i < 2; i++ {
+		reader, err := Gzip.GetReader(bytes.NewReader(BytesGzip(data, gzip.DefaultCompression)))
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, data, result)
+		Gzip.ReturnReader(reader)
+	}
+	_, err := Gzip.GetReader(strings.NewReader("not gzip"))
+	require.Error(t, err)
+	require.Nil(t, BytesUnGzip([]byte("not gzip")))
+
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	for i := 0; i < 2; i++ {
+		reader, err := Zlib.GetReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, data, result)
+		Zlib.ReturnReader(reader)
+	}
+	_, err = Zlib.GetReader(strings.NewReader("not zlib"))
+	require.Error(t, err)
+}
+
+func TestBytesDecompressErr(t *testing.T) {
+	data := []byte(strings.Repeat("0", 10000))
+
+	compressed, err := BytesDeflateErr(data, flate.BestSpeed)
+	require.NoError(t, err)
+	result, err := BytesInflateErr(compressed)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	_, err = BytesInflateErr(compressed, DecompressOptions{MaxSize: 9999})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+	result, err = BytesInflateErr(compressed, DecompressOptions{MaxSize: 10000})
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	_, err = BytesInflateErr(compressed[:len(compressed)/2])
+	require.Error(t, err)
+
+	compressed, err = BytesGzipErr(data)
+	require.NoError(t, err)
+	result, err = BytesUnGzipErr(compressed)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	_, err = BytesUnGzipErr(compressed, DecompressOptions{MaxSize: 100})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+	_, err = BytesUnGzipErr(compressed[:len(compressed)-4])
+	require.Error(t, err)
+	_, err = BytesUnGzipErr([]byte("not gzip"))
+	require.Error(t, err)
+
+	_, err = BytesGzipErr(data, 42)
+	require.Error(t, err)
+	_, err = BytesDeflateErr(data, -3)
+	require.Error(t, err)
+}
+
+func TestFileGetGzInflate(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("file data ", 100))
+
+	filename := filepath.Join(dir, "zlib.gz")
+	require.NoError(t, FileSetGz(filename, data))
+	result, err := FileGetGz(filename)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	_, err = FileGetGz(filename, DecompressOptions{MaxSize: 10})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+
+	filename = filepath.Join(dir, "real.gz")
+	require.NoError(t, FileSetBytes(filename, BytesGzip(data)))
+	result, err = FileGetGz(filename)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+
+	filename = filepath.Join(dir, "data.deflate")
+	require.NoError(t, FileSetDeflate(filename, data))
+	result, err = FileGetInflate(filename)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	_, err = FileGetInflate(filename, DecompressOptions{MaxSize: 10})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+
+	require.NoError(t, FileSetString(filename, "garbage"))
+	_, err = FileGetInflate(filename)
+	require.Error(t, err)
+}
+
+func TestBytesZlibLZW(t *testing.T) {
+	data := []byte(strings.Repeat("zlib and lzw ", 500))
+
+	for _, level := range []int{zlib.HuffmanOnly, zlib.BestSpeed, zlib.DefaultCompression, 42} {
+		require.Equal(t, data, BytesUnZlib(BytesZlib(data, level)))
+	}
+	require.Nil(t, BytesUnZlib([]byte("not zlib")))
+	compressed, err := BytesZlibErr(data)
+	require.NoError(t, err)
+	result, err := BytesUnZlibErr(compressed)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	_, err = BytesUnZlibErr(compressed, DecompressOptions{MaxSize: 100})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+	_, err = BytesUnZlibErr(compressed[:len(compressed)-2])
+	require.Error(t, err)
+
+	for i := 0; i < 2; i++ {
+		compressed = BytesLZW(data)
+		require.True(t, len(compressed) < len(data))
+		require.Equal(t, data, BytesUnLZW(compressed))
+	}
+	_, err = BytesUnLZWErr(compressed, DecompressOptions{MaxSize: 100})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+	_, err = BytesUnLZWErr(compressed[:len(compressed)/2])
+	require.Error(t, err)
+}
+
+func TestFileZlibLZW(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("file data ", 100))
+
+	filename := filepath.Join(dir, "data.zz")
+	require.NoError(t, FileSetZlib(filename, data))
+	result, err := FileGetZlib(filename)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	text, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, string(data), text)
+
+	filename = filepath.Join(dir, "data.lzw")
+	require.NoError(t, FileSetLZW(filename, data))
+	result, err = FileGetLZW(filename)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	text, err = FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, string(data), text)
+	_, err = FileGetLZW(filename, DecompressOptions{MaxSize: 10})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+}
+
+// testCodec is zlib with a magic prefix.
+type testCodec struct{}
+
+var testCodecMagic = []byte("XTZ1")
+
+func (testCodec) Name() string { return "x-test" }
+
+func (testCodec) NewWriter(dst io.Writer) (io.WriteCloser, error) {
+	if _, err := dst.Write(testCodecMagic); err != nil {
+		return nil, err
+	}
+	return zlib.NewWriter(dst), nil
+}
+
+func (testCodec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	magic := make([]byte, len(testCodecMagic))
+	if _, err := io.ReadFull(src, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, testCodecMagic) {
+		return nil, fmt.Errorf("invalid magic %q", magic)
+	}
+	return zlib.NewReader(src)
+}
+
+func (testCodec) Extensions() []string { return []string{".xt"} }
+func (testCodec) Magic() []byte        { return testCodecMagic }
+
+// registerTestCodec registers codec until the end of the test,
+// so other tests see the default registry.
+func registerTestCodec(t *testing.T, codec Codec) {
+	codecs := Codecs()
+	t.Cleanup(func() {
+		codecRegistry.Lock()
+		codecRegistry.codecs = codecs
+		codecRegistry.Unlock()
+	})
+	RegisterCodec(codec)
+}
+
+func TestCodecRegistry(t *testing.T) {
+	registerTestCodec(t, testCodec{})
+
+	require.Equal(t, "gzip", CodecByName("GZIP").Name())
+	require.Equal(t, "x-test", CodecByName("x-test").Name())
+	require.Nil(t, CodecByName("br"))
+	names := make([]string, 0)
+	for _, codec := range Codecs() {
+		names = append(names, codec.Name())
+	}
+	require.Equal(t, []string{"gzip", "deflate", "x-test"}, names)
+	// registering again replaces
+	RegisterCodec(testCodec{})
+	require.Len(t, Codecs(), 3)
+
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("codec data ", 100))
+	filename := filepath.Join(dir, "data.xt")
+	require.NoError(t, FileSetCompressed(filename, data))
+	compressed, err := FileGetBytes(filename)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(compressed, testCodecMagic))
+
+	c := FileCompressionOf(filename, compressed)
+	require.Equal(t, "x-test", c.String())
+	require.Equal(t, c, FileCompressionOf("", compressed), "detected by magic")
+	require.Equal(t, c, FileCompressionOf("other.xt", nil), "detected by extension")
+
+	result, err := FileGetDecompressed(filename)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+	require.NoError(t, os.Rename(filename, filepath.Join(dir, "data.bin")))
+	text, err := FileGetString(filepath.Join(dir, "data.bin"))
+	require.NoError(t, err)
+	require.Equal(t, string(data), text)
+}
+
+func TestRegisterTestCodec(t *testing.T) {
+	t.Run("register", func(t *testing.T) {
+		registerTestCodec(t, testCodec{})
+		require.NotNil(t, CodecByName("x-test"))
+	})
+	require.Nil(t, CodecByName("x-test"), "registry restored")
+	require.Len(t, Codecs(), 2)
+}
@@ -0,0 +1,463 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ConfigDocument is an editable .env or INI file.
+Comments, blank lines, key order and formatting of untouched entries
+survive a round trip through ParseConfigDocument and Bytes.
+
+Supported syntax:
+
+	# comment, also ; comment
+	export KEY=value            # "export " prefix is optional
+	PLAIN=value up to the end of the line, # included
+	SINGLE='no $EXPANSION, no \escapes' # comment after a quoted value
+	DOUBLE="escapes \n \t \" \\ \$ and ${VAR} expansion"
+	MULTI="first line
+	second line"
+	DEFAULT=${UNSET:-fallback}
+
+	[section]
+	key = value
+
+Value, Get and Map return the values as written, without quotes
+and with escapes of double quoted values resolved.
+ExpandedValue and ExpandedMap also replace ${VAR} and $VAR
+in unquoted and double quoted values. Variables are looked up
+in the same section, then in the top level keys, then in the environment
+of the process. Use single quotes, \$ in double quotes or $$
+in unquoted values for a literal dollar sign in expanded values.
+A quote without a closing one is kept as part of an unquoted value.
+If a key appears more than once in a section, the last one counts
+like when a shell sources the file.
+*/
+type ConfigDocument struct {
+	entries []*configEntry
+	newline string
+}
+
+type configEntryKind int
+
+const (
+	configOther configEntryKind = iota // blank lines, comments and unparsable lines
+	configSection
+	configKeyValue
+)
+
+type configEntry struct {
+	kind    configEntryKind
+	raw     []string // physical lines, nil if the entry was changed
+	section string
+	key     string
+	value   string // unquoted and unescaped
+	// template is value for os.Expand with escaped dollar signs as "$$",
+	// only used if expand is set
+	template string
+	expand   bool
+	export   bool
+	comment  string
+}
+
+// ParseConfigDocument parses data in .env or INI syntax.
+func ParseConfigDocument(data []byte) (*ConfigDocument, error) {
+	text := string(data)
+	doc := &ConfigDocument{newline: "\n"}
+	if strings.Contains(text, "\r\n") {
+		doc.newline = "\r\n"
+		text = strings.Replace(text, "\r\n", "\n", -1)
+	}
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return doc, nil
+	}
+	lines := strings.Split(text, "\n")
+
+	section := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		entry := &configEntry{raw: []string{line}, section: section}
+		doc.entries = append(doc.entries, entry)
+
+		switch {
+		case trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';':
+			continue
+		case trimmed[0] == '[' && trimmed[len(trimmed)-1] == ']':
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			entry.kind, entry.section = configSection, section
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "export ") {
+			entry.export = true
+			trimmed = strings.TrimSpace(trimmed[len("export "):])
+		}
+		key, value := StringSplitOnceChar(trimmed, '=')
+		key = strings.TrimSpace(key)
+		if key == "" || !strings.ContainsRune(trimmed, '=') {
+			continue
+		}
+		entry.kind, entry.key = configKeyValue, key
+
+		value = strings.TrimSpace(value)
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			entry.value, entry.template, entry.expand = value, value, true
+			continue
+		}
+
+		// quoted values can span multiple lines
+		quote := value[0]
+		rest := value[1:]
+		end := configClosingQuote(rest, quote)
+		for j := i + 1; end < 0 && j < len(lines); j++ {
+			rest += "\n" + lines[j]
+			end = configClosingQuote(rest, quote)
+			if end >= 0 {
+				entry.raw = append(entry.raw, lines[i+1:j+1]...)
+				i = j
+			}
+		}
+		if end < 0 {
+			// an unterminated quote is part of an unquoted value
+			entry.value, entry.template, entry.expand = value, value, true
+			continue
+		}
+		entry.value = rest[:end]
+		_, entry.comment = configSplitComment(" " + strings.TrimSpace(rest[end+1:]))
+		if quote == '"' {
+			entry.value = configUnescape(rest[:end], "$")
+			entry.template = configUnescape(rest[:end], "$$")
+			entry.expand = true
+		}
+	}
+	return doc, nil
+}
+
+// configClosingQuote returns the index of the first unescaped quote in s.
+// Backslashes only escape in double quoted values.
+func configClosingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// configSplitComment splits the text after a closing quote from a comment
+// starting with whitespace followed by '#'.
+func configSplitComment(s string) (value, comment string) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '#' && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i]), s[i:]
+		}
+	}
+	if strings.HasPrefix(s, "#") {
+		return "", s
+	}
+	return strings.TrimSpace(s), ""
+}
+
+// configUnescape resolves backslash escapes of a double quoted value,
+// escaped dollar signs become dollar.
+func configUnescape(s, dollar string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '$':
+			b.WriteString(dollar)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// find returns the last entry of key in section.
+func (doc *ConfigDocument) find(section, key string) *configEntry {
+	for i := len(doc.entries) - 1; i >= 0; i-- {
+		entry := doc.entries[i]
+		if entry.kind == configKeyValue && entry.section == section && entry.key == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Value returns the value of key in section as written, see ConfigDocument.
+// The top level section is "".
+func (doc *ConfigDocument) Value(section, key string) (value string, found bool) {
+	entry := doc.find(section, key)
+	if entry == nil {
+		return "", false
+	}
+	return entry.value, true
+}
+
+// ExpandedValue is like Value, but with all variables expanded.
+func (doc *ConfigDocument) ExpandedValue(section, key string) (value string, found bool) {
+	entry := doc.find(section, key)
+	if entry == nil {
+		return "", false
+	}
+	return doc.expand(entry, 0), true
+}
+
+// Get returns the value of a top level key, or "" if it doesn't exist.
+func (doc *ConfigDocument) Get(key string) string {
+	value, _ := doc.Value("", key)
+	return value
+}
+
+// configMaxExpandDepth stops expansion of self referencing variables.
+const configMaxExpandDepth = 16
+
+func (doc *ConfigDocument) expand(entry *configEntry, depth int) string {
+	if !entry.expand {
+		return entry.value
+	}
+	return os.Expand(entry.template, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		var fallback string
+		if i := strings.Index(name, ":-"); i != -1 {
+			name, fallback = name[:i], name[i+2:]
+		}
+		if depth < configMaxExpandDepth {
+			for _, section := range []string{entry.section, ""} {
+				if ref := doc.find(section, name); ref != nil && ref != entry {
+					if value := doc.expand(ref, depth+1); value != "" {
+						return value
+					}
+				}
+			}
+		}
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			return value
+		}
+		return fallback
+	})
+}
+
+// Set changes the value of key in section, or adds it after the last key
+// of the section. A missing section gets appended to the document.
+func (doc *ConfigDocument) Set(section, key, value string) {
+	if entry := doc.find(section, key); entry != nil {
+		entry.value, entry.expand = value, false
+		entry.raw = nil
+		return
+	}
+
+	entry := &configEntry{kind: configKeyValue, section: section, key: key, value: value}
+	insert := -1
+	for i, e := range doc.entries {
+		if e.section != section {
+			continue
+		}
+		if e.kind == configKeyValue || e.kind == configSection {
+			insert = i + 1
+		}
+	}
+	if insert == -1 {
+		if section == "" {
+			insert = 0
+		} else {
+			if len(doc.entries) > 0 {
+				doc.entries = append(doc.entries, &configEntry{kind: configOther, section: section})
+			}
+			doc.entries = append(doc.entries, &configEntry{kind: configSection, section: section})
+			insert = len(doc.entries)
+		}
+	}
+	doc.entries = append(doc.entries, nil)
+	copy(doc.entries[insert+1:], doc.entries[insert:])
+	doc.entries[insert] = entry
+}
+
+// Delete removes all entries of key from section and returns if it existed.
+func (doc *ConfigDocument) Delete(section, key string) bool {
+	entries := doc.entries[:0]
+	for _, entry := range doc.entries {
+		if entry.kind != configKeyValue || entry.section != section || entry.key != key {
+			entries = append(entries, entry)
+		}
+	}
+	deleted := len(entries) < len(doc.entries)
+	doc.entries = entries
+	return deleted
+}
+
+// Sections returns all section names in document order,
+// starting with "" if there are top level keys.
+func (doc *ConfigDocument) Sections() []string {
+	var sections []string
+	seen := make(StringSet)
+	for _, entry := range doc.entries {
+		if (entry.kind == configSection || entry.kind == configKeyValue) && !seen.Has(entry.section) {
+			seen.Set(entry.section)
+			sections = append(sections, entry.section)
+		}
+	}
+	return sections
+}
+
+// Keys returns the keys of section in document order,
+// duplicate keys only at their first position.
+func (doc *ConfigDocument) Keys(section string) []string {
+	var keys []string
+	seen := make(StringSet)
+	for _, entry := range doc.entries {
+		if entry.kind == configKeyValue && entry.section == section && !seen.Has(entry.key) {
+			seen.Set(entry.key)
+			keys = append(keys, entry.key)
+		}
+	}
+	return keys
+}
+
+// Map returns all values as written. Keys of sections are prefixed with "section.",
+// of duplicate keys the last value is returned like by Value.
+func (doc *ConfigDocument) Map() map[string]string {
+	return doc.toMap(func(entry *configEntry) string { return entry.value })
+}
+
+// ExpandedMap is like Map, but with all variables expanded.
+func (doc *ConfigDocument) ExpandedMap() map[string]string {
+	return doc.toMap(func(entry *configEntry) string { return doc.expand(entry, 0) })
+}
+
+func (doc *ConfigDocument) toMap(value func(*configEntry) string) map[string]string {
+	result := make(map[string]string)
+	for _, entry := range doc.entries {
+		if entry.kind != configKeyValue {
+			continue
+		}
+		key := entry.key
+		if entry.section != "" {
+			key = entry.section + "." + key
+		}
+		result[key] = value(entry)
+	}
+	return result
+}
+
+// Bytes formats the document. Unchanged entries keep their original text.
+func (doc *ConfigDocument) Bytes() []byte {
+	var b strings.Builder
+	for _, entry := range doc.entries {
+		if entry.raw != nil {
+			for _, line := range entry.raw {
+				b.WriteString(line)
+				b.WriteString(doc.newline)
+			}
+			continue
+		}
+		switch entry.kind {
+		case configSection:
+			b.WriteString("[" + entry.section + "]")
+		case configKeyValue:
+			if entry.export {
+				b.WriteString("export ")
+			}
+			// a comment after an unquoted value would be part of it
+			b.WriteString(entry.key + "=" + configQuote(entry.value, entry.comment != ""))
+			if entry.comment != "" {
+				b.WriteString(" " + entry.comment)
+			}
+		}
+		b.WriteString(doc.newline)
+	}
+	return []byte(b.String())
+}
+
+// configQuote formats a literal value so that it parses back unchanged,
+// always quoted if force is set.
+func configQuote(value string, force bool) string {
+	if !force && !strings.ContainsAny(value, " \t\r\n#'\"\\$;") {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\r\n") {
+		return "'" + value + "'"
+	}
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"$", `\$`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+	).Replace(value) + `"`
+}
+
+// Save writes the document to filename, see FileWriteOptions.
+func (doc *ConfigDocument) Save(filename string, options ...FileWriteOptions) error {
+	return FileSetBytes(filename, doc.Bytes(), options...)
+}
+
+// FileGetConfigDocument reads and parses filenameOrURL, see ConfigDocument.
+func FileGetConfigDocument(filenameOrURL string, timeout ...time.Duration) (*ConfigDocument, error) {
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetConfigDocumentContext(ctx, filenameOrURL)
+}
+
+func FileGetConfigDocumentContext(ctx context.Context, filenameOrURL string) (*ConfigDocument, error) {
+	data, err := FileGetDecompressedContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfigDocument(data)
+}
+
+// configSplitMapKey splits a key of ConfigDocument.Map into section and key.
+// Dotted keys only belong to a section if doc has it.
+func configSplitMapKey(doc *ConfigDocument, mapKey string) (section, key string) {
+	if section, key = StringSplitOnceChar(mapKey, '.'); key != "" {
+		for _, s := range doc.Sections() {
+			if s == section && s != "" {
+				return section, key
+			}
+		}
+	}
+	return "", mapKey
+}
+
+// configSortedKeys returns the keys of config, so new keys are added deterministically.
+func configSortedKeys(config map[string]string) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
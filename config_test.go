@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `# database settings
+export HOST=localhost
+PORT="5432" # default port
+USER='admin $NOT_EXPANDED'
+URL="postgres://${USER_NAME:-guest}@${HOST}:$PORT\tdb"
+PRICE="\$5"
+CERT="-----BEGIN-----
+abc
+-----END-----"
+
+[cache]
+; ini style comment
+host = ${HOST}
+ttl = 60
+`
+
+func Test_ParseConfigDocument(t *testing.T) {
+	os.Unsetenv("USER_NAME")
+	doc, err := ParseConfigDocument([]byte(testConfig))
+	require.NoError(t, err)
+
+	require.Equal(t, "localhost", doc.Get("HOST"))
+	require.Equal(t, "5432", doc.Get("PORT"))
+	require.Equal(t, "admin $NOT_EXPANDED", doc.Get("USER"))
+	require.Equal(t, "postgres://${USER_NAME:-guest}@${HOST}:$PORT\tdb", doc.Get("URL"))
+	require.Equal(t, "$5", doc.Get("PRICE"))
+	require.Equal(t, "-----BEGIN-----\nabc\n-----END-----", doc.Get("CERT"))
+	value, found := doc.Value("cache", "host")
+	require.True(t, found)
+	require.Equal(t, "${HOST}", value)
+	require.Equal(t, []string{"", "cache"}, doc.Sections())
+	require.Equal(t, []string{"host", "ttl"}, doc.Keys("cache"))
+	require.Equal(t, "60", doc.Map()["cache.ttl"])
+
+	// variables are only expanded on request
+	value, found = doc.ExpandedValue("cache", "host")
+	require.True(t, found)
+	require.Equal(t, "localhost", value)
+	_, found = doc.ExpandedValue("cache", "missing")
+	require.False(t, found)
+	expanded := doc.ExpandedMap()
+	require.Equal(t, "postgres://guest@localhost:5432\tdb", expanded["URL"])
+	require.Equal(t, "admin $NOT_EXPANDED", expanded["USER"])
+	require.Equal(t, "$5", expanded["PRICE"])
+
+	require.Equal(t, testConfig, string(doc.Bytes()))
+
+	// unterminated quotes are kept like FileGetConfig always did
+	doc, err = ParseConfigDocument([]byte("A=1\nB=\"open\nC='x\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"A": "1", "B": `"open`, "C": "'x"}, doc.Map())
+	require.Equal(t, "A=1\nB=\"open\nC='x\n", string(doc.Bytes()))
+
+	// the last of duplicate keys counts everywhere
+	doc, err = ParseConfigDocument([]byte("A=1\nB=$A\nA=2\n"))
+	require.NoError(t, err)
+	require.Equal(t, "2", doc.Get("A"))
+	require.Equal(t, map[string]string{"A": "2", "B": "$A"}, doc.Map())
+	require.Equal(t, map[string]string{"A": "2", "B": "2"}, doc.ExpandedMap())
+	require.Equal(t, []string{"A", "B"}, doc.Keys(""))
+	require.True(t, doc.Delete("", "A"))
+	require.Equal(t, "B=$A\n", string(doc.Bytes()))
+
+	// literal dollar signs in unquoted values
+	doc, err = ParseConfigDocument([]byte("PRICE=$$5\n"))
+	require.NoError(t, err)
+	require.Equal(t, "$$5", doc.Get("PRICE"))
+	require.Equal(t, "$5", doc.ExpandedMap()["PRICE"])
+
+	// unquoted values are taken as written
+	doc, err = ParseConfigDocument([]byte("PASSWORD=abc$def\nURL=http://x/#frag\nNOTE=a # b\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"PASSWORD": "abc$def", "URL": "http://x/#frag", "NOTE": "a # b"}, doc.Map())
+}
+
+func Test_ConfigDocumentEdit(t *testing.T) {
+	doc, err := ParseConfigDocument([]byte(testConfig))
+	require.NoError(t, err)
+
+	doc.Set("", "PORT", "6543")
+	doc.Set("", "NEW", "it's $1\n")
+	doc.Set("cache", "size", "10 MB")
+	doc.Set("log", "level", "debug")
+	require.True(t, doc.Delete("", "PRICE"))
+	require.False(t, doc.Delete("", "PRICE"))
+
+	reparsed, err := ParseConfigDocument(doc.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, doc.Map(), reparsed.Map())
+	require.Equal(t, "it's $1\n", reparsed.Get("NEW"))
+	require.Contains(t, string(doc.Bytes()), "PORT='6543' # default port\n")
+	require.Contains(t, string(doc.Bytes()), "ttl = 60\nsize='10 MB'\n\n[log]\nlevel=debug\n")
+	require.Equal(t, []string{"HOST", "PORT", "USER", "URL", "CERT", "NEW"}, reparsed.Keys(""))
+}
+
+func Test_FileSetConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.env")
+	require.NoError(t, FileSetString(filename, "# keep me\nB=2\nA=1\n\n[s]\nk=v\n"))
+
+	require.NoError(t, FileSetConfig(filename, map[string]string{"A": "1", "B": "3", "C": "x y", "s.k": "w"}))
+	str, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "# keep me\nB=3\nA=1\nC='x y'\n\n[s]\nk=w\n", str)
+
+	config, err := FileGetConfig(filename)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"A": "1", "B": "3", "C": "x y", "s.k": "w"}, config)
+
+	// values are returned as written, so unchanged ones are kept
+	require.NoError(t, FileSetString(filename, "PASSWORD=abc$def\nURL=http://x/#frag\nHOME_DIR=$HOME\n"))
+	config, err = FileGetConfig(filename)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"PASSWORD": "abc$def", "URL": "http://x/#frag", "HOME_DIR": "$HOME"}, config)
+	config["URL"] = "http://y/"
+	require.NoError(t, FileSetConfig(filename, config))
+	str, err = FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "PASSWORD=abc$def\nURL=http://y/\nHOME_DIR=$HOME\n", str)
+
+	// a file that can't be read is not overwritten
+	broken := filepath.Join(t.TempDir(), "broken.env")
+	content := "\x1f\x8b not really gzip\nA=1\n"
+	require.NoError(t, FileSetString(broken, content))
+	require.Error(t, FileSetConfig(broken, map[string]string{"A": "2"}))
+	str, err = FileGetString(broken)
+	require.Error(t, err)
+	raw, err := FileGetBytes(broken)
+	require.NoError(t, err)
+	require.Equal(t, content, string(raw))
+
+	missing := filepath.Join(t.TempDir(), "new.env")
+	require.NoError(t, FileSetConfig(missing, map[string]string{"A": "2"}))
+	str, err = FileGetString(missing)
+	require.NoError(t, err)
+	require.Equal(t, "A=2\n", str)
+}
@@ -6,19 +6,15 @@
 package dry
 
 import (
-	"bufio"
 	"bytes"
-	"compress/flate"
-	"compress/zlib"
-	"crypto/md5"
+	"context"
+	"encoding/binary"
 	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"hash/crc64"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 
@@ -35,33 +31,51 @@ func FileBufferedReader(filenameOrURL string) (io.Reader, error) {
 	return BytesReader(data), nil
 }
 
+// FileGetBytes reads filenameOrURL completely.
+// Local files and file:// URLs are read from disk, everything else
+// is opened by the scheme opener registered via FileRegisterScheme.
+// The first optional timeout limits the whole operation.
 func FileGetBytes(filenameOrURL string, timeout ...time.Duration) ([]byte, error) {
-	if strings.Contains(filenameOrURL, "://") {
-		if strings.Index(filenameOrURL, "file://") == 0 {
-			filenameOrURL = filenameOrURL[len("file://"):]
-		} else {
-			client := http.DefaultClient
-			if len(timeout) > 0 {
-				client = &http.Client{Timeout: timeout[0]}
-			}
-			r, err := client.Get(filenameOrURL)
-			if err != nil {
-				return nil, err
-			}
-			defer r.Body.Close()
-			if r.StatusCode < 200 || r.StatusCode > 299 {
-				return nil, fmt.Errorf("%d: %s", r.StatusCode, http.StatusText(r.StatusCode))
-			}
-			return ioutil.ReadAll(r.Body)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetBytesContext(ctx, filenameOrURL)
+}
+
+// FileGetBytesContext reads filenameOrURL completely.
+// Local files are read in chunks, so a canceled ctx aborts the read
+// even for huge or slow (e.g. NFS) files.
+func FileGetBytesContext(ctx context.Context, filenameOrURL string) ([]byte, error) {
+	if path, ok := fileLocalPath(filenameOrURL); ok {
+		file, err := fileOpenLocal(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		var size int64
+		if info, err := file.Stat(); err == nil {
+			size = info.Size()
 		}
+		return fileReadAllContext(ctx, file, size)
+	}
+	reader, err := FileOpenContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
 	}
-	return ioutil.ReadFile(filenameOrURL)
+	defer reader.Close()
+	return fileReadAllContext(ctx, reader, 0)
 }
 
-func FileSetBytes(filename string, data []byte) error {
-	return ioutil.WriteFile(filename, data, 0660)
+// FileSetBytes writes data to filename.
+// The first optional options can make the write atomic, see FileWriteOptions.
+func FileSetBytes(filename string, data []byte, options ...FileWriteOptions) error {
+	return fileWrite(filename, options, func(writer io.Writer) error {
+		_, err := WriteFull(data, writer)
+		return err
+	})
 }
 
+// FileAppendBytes opens and closes filename for every call,
+// use RotatingFile for long-lived log files.
 func FileAppendBytes(filename string, data []byte) error {
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
 	if err != nil {
@@ -73,15 +87,21 @@ func FileAppendBytes(filename string, data []byte) error {
 }
 
 func FileGetString(filenameOrURL string, timeout ...time.Duration) (string, error) {
-	bytes, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetStringContext(ctx, filenameOrURL)
+}
+
+func FileGetStringContext(ctx context.Context, filenameOrURL string) (string, error) {
+	bytes, err := FileGetDecompressedContext(ctx, filenameOrURL)
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
 
-func FileSetString(filename string, data string) error {
-	return FileSetBytes(filename, []byte(data))
+func FileSetString(filename string, data string, options ...FileWriteOptions) error {
+	return FileSetBytes(filename, []byte(data), options...)
 }
 
 func FileAppendString(filename string, data string) error {
@@ -93,28 +113,39 @@ func FileGetJSON(filenameOrURL string, timeout ...time.Duration) (result any, er
 	return result, err
 }
 
+func FileGetJSONContext(ctx context.Context, filenameOrURL string) (result any, err error) {
+	err = FileUnmarshallJSONContext(ctx, filenameOrURL, &result)
+	return result, err
+}
+
 func FileUnmarshallJSON(filenameOrURL string, result any, timeout ...time.Duration) error {
-	data, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileUnmarshallJSONContext(ctx, filenameOrURL, result)
+}
+
+func FileUnmarshallJSONContext(ctx context.Context, filenameOrURL string, result any) error {
+	data, err := FileGetDecompressedContext(ctx, filenameOrURL)
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal(data, result)
 }
 
-func FileSetJSON(filename string, data any) error {
+func FileSetJSON(filename string, data any, options ...FileWriteOptions) error {
 	bytes, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return FileSetBytes(filename, bytes)
+	return FileSetBytes(filename, bytes, options...)
 }
 
-func FileSetJSONIndent(filename string, data any, indent string) error {
+func FileSetJSONIndent(filename string, data any, indent string, options ...FileWriteOptions) error {
 	bytes, err := json.MarshalIndent(data, "", indent)
 	if err != nil {
 		return err
 	}
-	return FileSetBytes(filename, bytes)
+	return FileSetBytes(filename, bytes, options...)
 }
 
 func FileGetXML(filenameOrURL string, timeout ...time.Duration) (result any, err error) {
@@ -122,24 +153,41 @@ func FileGetXML(filenameOrURL string, timeout ...time.Duration) (result any, err
 	return result, err
 }
 
+func FileGetXMLContext(ctx context.Context, filenameOrURL string) (result any, err error) {
+	err = FileUnmarshallXMLContext(ctx, filenameOrURL, &result)
+	return result, err
+}
+
 func FileUnmarshallXML(filenameOrURL string, result any, timeout ...time.Duration) error {
-	data, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileUnmarshallXMLContext(ctx, filenameOrURL, result)
+}
+
+func FileUnmarshallXMLContext(ctx context.Context, filenameOrURL string, result any) error {
+	data, err := FileGetDecompressedContext(ctx, filenameOrURL)
 	if err != nil {
 		return err
 	}
 	return xml.Unmarshal(data, result)
 }
 
-func FileSetXML(filename string, data any) error {
+func FileSetXML(filename string, data any, options ...FileWriteOptions) error {
 	bytes, err := xml.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return FileSetBytes(filename, bytes)
+	return FileSetBytes(filename, bytes, options...)
 }
 
 func FileGetCSV(filenameOrURL string, timeout ...time.Duration) ([][]string, error) {
-	data, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetCSVContext(ctx, filenameOrURL)
+}
+
+func FileGetCSVContext(ctx context.Context, filenameOrURL string) ([][]string, error) {
+	data, err := FileGetDecompressedContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
@@ -147,20 +195,22 @@ func FileGetCSV(filenameOrURL string, timeout ...time.Duration) ([][]string, err
 	return reader.ReadAll()
 }
 
-func FileSetCSV(filename string, records [][]string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	writer := csv.NewWriter(file)
-	return writer.WriteAll(records)
+func FileSetCSV(filename string, records [][]string, options ...FileWriteOptions) error {
+	return fileWrite(filename, options, func(file io.Writer) error {
+		return csv.NewWriter(file).WriteAll(records)
+	})
 }
 
 // FileGetLines returns a string slice with the text lines of filenameOrURL.
 // The lines can be separated by \n or \r\n.
 func FileGetLines(filenameOrURL string, timeout ...time.Duration) (lines []string, err error) {
-	data, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetLinesContext(ctx, filenameOrURL)
+}
+
+func FileGetLinesContext(ctx context.Context, filenameOrURL string) (lines []string, err error) {
+	data, err := FileGetDecompressedContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
@@ -188,14 +238,20 @@ func FileGetLines(filenameOrURL string, timeout ...time.Duration) (lines []strin
 	return lines, nil
 }
 
-func FileSetLines(filename string, lines []string) error {
-	return FileSetString(filename, strings.Join(lines, "\n"))
+func FileSetLines(filename string, lines []string, options ...FileWriteOptions) error {
+	return FileSetString(filename, strings.Join(lines, "\n"), options...)
 }
 
 // FileGetNonEmptyLines returns a string slice with the non empty text lines of filenameOrURL.
 // The lines can be separated by \n or \r\n.
 func FileGetNonEmptyLines(filenameOrURL string, timeout ...time.Duration) (lines []string, err error) {
-	data, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetNonEmptyLinesContext(ctx, filenameOrURL)
+}
+
+func FileGetNonEmptyLinesContext(ctx context.Context, filenameOrURL string) (lines []string, err error) {
+	data, err := FileGetDecompressedContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
@@ -229,63 +285,84 @@ func FileGetNonEmptyLines(filenameOrURL string, timeout ...time.Duration) (lines
 	return lines, nil
 }
 
+// FileGetConfig reads a .env or INI file, see ConfigDocument for the syntax.
+// Keys of sections are returned as "section.key". Values are returned
+// as written without quotes, variables are not expanded,
+// use FileGetConfigDocument and ConfigDocument.ExpandedMap for that.
 func FileGetConfig(filenameOrURL string, timeout ...time.Duration) (map[string]string, error) {
-	data, err := FileGetBytes(filenameOrURL, timeout...)
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetConfigContext(ctx, filenameOrURL)
+}
+
+func FileGetConfigContext(ctx context.Context, filenameOrURL string) (map[string]string, error) {
+	doc, err := FileGetConfigDocumentContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
-
-	lines := bytes.Split(data, []byte("\n"))
-	config := make(map[string]string, len(lines))
-	for _, line := range lines {
-		kv := bytes.SplitN(line, []byte("="), 2)
-		if len(kv) < 2 {
-			continue
-		}
-		key := string(bytes.TrimSpace(kv[0]))
-		if len(key) == 0 || key[0] == '#' {
-			continue
-		}
-		value := string(bytes.TrimSpace(kv[1]))
-		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
-			value = value[1 : len(value)-1]
-		}
-		config[key] = value
-	}
-
-	return config, nil
+	return doc.Map(), nil
 }
 
-func FileSetConfig(filename string, config map[string]string) error {
-	var buffer bytes.Buffer
-	for key, value := range config {
+// FileSetConfig writes config to filename.
+// If filename already is a config file, only changed keys are rewritten
+// and comments and order are preserved. Keys missing in config are removed,
+// new ones are added in sorted order. A key "section.key" goes into the section
+// if the file has it, see FileGetConfig.
+// A file that can't be read is not overwritten, instead the error is returned.
+func FileSetConfig(filename string, config map[string]string, options ...FileWriteOptions) error {
+	for key := range config {
 		if strings.ContainsRune(key, '=') {
 			return fmt.Errorf("Key '%s' contains '='", key)
 		}
-		fmt.Fprintf(&buffer, "%s=%s\n", key, value)
 	}
-	return FileSetBytes(filename, buffer.Bytes())
+	doc, err := FileGetConfigDocument(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		doc, err = &ConfigDocument{newline: "\n"}, nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, section := range doc.Sections() {
+		for _, key := range doc.Keys(section) {
+			mapKey := key
+			if section != "" {
+				mapKey = section + "." + key
+			}
+			if _, ok := config[mapKey]; !ok {
+				doc.Delete(section, key)
+			}
+		}
+	}
+	for _, mapKey := range configSortedKeys(config) {
+		section, key := configSplitMapKey(doc, mapKey)
+		if old, ok := doc.Value(section, key); !ok || old != config[mapKey] {
+			doc.Set(section, key, config[mapKey])
+		}
+	}
+	return doc.Save(filename, options...)
 }
 
-// FileGetLastLine reads the last line from a file.
+// FileGetLastLine reads the last line from a file,
+// which is empty if the file ends with a newline.
 // In case of a network file, the whole file is read.
-// In case of a local file, the last 64kb are read,
-// so if the last line is longer than 64kb it is not returned completely.
-// The first optional timeout is used for network files only.
+// In case of a local file, only the last line is read regardless of its length.
+// The first optional timeout limits the whole operation.
 func FileGetLastLine(filenameOrURL string, timeout ...time.Duration) (line string, err error) {
-	if strings.Index(filenameOrURL, "file://") == 0 {
-		return FileGetLastLine(filenameOrURL[len("file://"):])
-	}
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetLastLineContext(ctx, filenameOrURL)
+}
 
+func FileGetLastLineContext(ctx context.Context, filenameOrURL string) (line string, err error) {
 	var data []byte
 
-	if strings.Contains(filenameOrURL, "://") {
-		data, err = FileGetBytes(filenameOrURL, timeout...)
+	if path, ok := fileLocalPath(filenameOrURL); !ok {
+		data, err = FileGetBytesContext(ctx, filenameOrURL)
 		if err != nil {
 			return "", err
 		}
 	} else {
-		file, err := os.Open(filenameOrURL)
+		file, err := os.Open(path)
 		if err != nil {
 			return "", err
 		}
@@ -294,10 +371,21 @@ func FileGetLastLine(filenameOrURL string, timeout ...time.Duration) (line strin
 		if err != nil {
 			return "", err
 		}
-		if start := info.Size() - 64*1024; start > 0 {
-			file.Seek(start, os.SEEK_SET)
+		size := info.Size()
+		if size > 0 {
+			last := make([]byte, 1)
+			if _, err = file.ReadAt(last, size-1); err != nil {
+				return "", err
+			}
+			if last[0] == '\n' {
+				return "", nil
+			}
 		}
-		data, err = ioutil.ReadAll(file)
+		start, err := fileTailOffset(ctx, file, size, 1)
+		if err != nil {
+			return "", err
+		}
+		data, err = fileReadAllContext(ctx, io.NewSectionReader(file, start, size-start), size-start)
 		if err != nil {
 			return "", err
 		}
@@ -307,41 +395,6 @@ func FileGetLastLine(filenameOrURL string, timeout ...time.Duration) (line strin
 	return string(data[pos+1:]), nil
 }
 
-// func FileTail(filenameOrURL string, numLines int, timeout ...time.Duration) (lines []string, err error) {
-// 	if strings.Index(filenameOrURL, "file://") == 0 {
-// 		filenameOrURL = filenameOrURL[len("file://"):]
-// 	} else if strings.Contains(filenameOrURL, "://") {
-// 		data, err := FileGetBytes(filenameOrURL, timeout...)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		lines, _ := BytesTail(data, numLines)
-// 		return lines, nil
-// 	}
-
-// 	// data := make([]byte, 0, 1024*256)
-
-// 	// file, err := os.Open(filenameOrURL)
-// 	// if err != nil {
-// 	// 	return nil, err
-// 	// }
-// 	// defer file.Close()
-// 	// info, err := file.Stat()
-// 	// if err != nil {
-// 	// 	return nil, err
-// 	// }
-// 	// if start := info.Size() - 64*1024; start > 0 {
-// 	// 	file.Seek(start, os.SEEK_SET)
-// 	// }
-// 	// data, err = ioutil.ReadAll(file)
-// 	// if err != nil {
-// 	// 	return nil, err
-// 	// }
-
-// 	return lines, nil
-
-// }
-
 // FileTimeModified returns the modified time of a file,
 // or the zero time value in case of an error.
 func FileTimeModified(filename string) time.Time {
@@ -362,22 +415,41 @@ func FileIsDir(dirname string) bool {
 	return err == nil && info.IsDir()
 }
 
+// FileFind returns the first existing file of filenames in the first searchDirs
+// that has one. filenames are used literally, see FileFindGlob for patterns.
 func FileFind(searchDirs []string, filenames ...string) (filePath string, found bool) {
-	for _, dir := range searchDirs {
-		for _, filename := range filenames {
-			filePath = filepath.Join(dir, filename)
-			if FileExists(filePath) {
-				return filePath, true
-			}
-		}
-	}
-	return "", false
+	filePath, found, _ = fileFind(searchDirs, filenames, false, false)
+	return filePath, found
 }
 
+// FileFindModified works like FileFind and also returns
+// the modification time of the found file.
 func FileFindModified(searchDirs []string, filenames ...string) (filePath string, found bool, modified time.Time) {
+	return fileFind(searchDirs, filenames, false, true)
+}
+
+// FileFindGlob works like FileFind, but patterns are glob patterns,
+// see FileGlob. The first match in sorted order is used.
+func FileFindGlob(searchDirs []string, patterns ...string) (filePath string, found bool) {
+	filePath, found, _ = fileFind(searchDirs, patterns, true, false)
+	return filePath, found
+}
+
+// FileFindGlobModified works like FileFindGlob and also returns
+// the modification time of the found file.
+func FileFindGlobModified(searchDirs []string, patterns ...string) (filePath string, found bool, modified time.Time) {
+	return fileFind(searchDirs, patterns, true, true)
+}
+
+func fileFind(searchDirs, filenames []string, glob, withModified bool) (filePath string, found bool, modified time.Time) {
 	for _, dir := range searchDirs {
 		for _, filename := range filenames {
-			filePath = filepath.Join(dir, filename)
+			if filePath, found = fileFindIn(dir, filename, glob); !found {
+				continue
+			}
+			if !withModified {
+				return filePath, true, time.Time{}
+			}
 			if t := FileTimeModified(filePath); !t.IsZero() {
 				return filePath, true, t
 			}
@@ -386,6 +458,20 @@ func FileFindModified(searchDirs []string, filenames ...string) (filePath string
 	return "", false, time.Time{}
 }
 
+func fileFindIn(dir, filename string, glob bool) (filePath string, found bool) {
+	filePath = filepath.Join(dir, filename)
+	if !glob || !fileHasGlobMeta(filename) {
+		return filePath, FileExists(filePath)
+	}
+	matches, _ := FileGlob(filePath)
+	for _, match := range matches {
+		if FileExists(match) {
+			return match, true
+		}
+	}
+	return "", false
+}
+
 func FileTouch(filename string) error {
 	if FileExists(filename) {
 		now := time.Now()
@@ -406,91 +492,99 @@ func FileMD5String(filenameOrURL string) (string, error) {
 	return fmt.Sprintf("%x", sum), nil
 }
 
+// FileMD5Bytes streams filenameOrURL through MD5, see FileHashes for other algorithms.
 func FileMD5Bytes(filenameOrURL string) ([]byte, error) {
-	data, err := FileGetBytes(filenameOrURL)
+	sums, err := FileHashes(filenameOrURL, HashMD5)
 	if err != nil {
 		return nil, err
 	}
-	hash := md5.New()
-	_, err = io.Copy(hash, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-	return hash.Sum(nil), nil
+	return sums[HashMD5], nil
 }
 
-var crc64Table *crc64.Table
-
+// FileCRC64 streams filenameOrURL through CRC-64 with the ECMA polynomial.
 func FileCRC64(filenameOrURL string) (uint64, error) {
-	data, err := FileGetBytes(filenameOrURL)
+	sums, err := FileHashes(filenameOrURL, HashCRC64)
 	if err != nil {
 		return 0, err
 	}
-	if crc64Table == nil {
-		crc64Table = crc64.MakeTable(crc64.ECMA)
-	}
-	return crc64.Checksum(data, crc64Table), nil
+	return binary.BigEndian.Uint64(sums[HashCRC64]), nil
 }
 
-func FileGetInflate(filenameOrURL string) ([]byte, error) {
-	data, err := FileGetBytes(filenameOrURL)
+// FileGetInflate returns the decompressed content of a raw deflate file.
+// The first optional options can limit the decompressed size, see BytesInflateErr.
+func FileGetInflate(filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	return FileGetInflateContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileGetInflateContext(ctx context.Context, filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	data, err := FileGetBytesContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
-	reader := flate.NewReader(bytes.NewBuffer(data))
-	defer reader.Close()
-	return ioutil.ReadAll(reader)
+	return BytesInflateErr(data, options...)
 }
 
-func FileSetDeflate(filename string, data []byte) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	fileBuf := bufio.NewWriter(file)
-	defer fileBuf.Flush()
-	writer, err := flate.NewWriter(fileBuf, flate.BestCompression)
+func FileSetDeflate(filename string, data []byte, options ...FileWriteOptions) error {
+	return fileWriteCompressed(filename, FileDeflate, data, options)
+}
+
+// FileGetGz returns the decompressed content of a file written by FileSetGz,
+// which uses zlib. Files in gzip format are decompressed as well.
+// The first optional options can limit the decompressed size, see BytesUnGzipErr.
+func FileGetGz(filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	return FileGetGzContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileGetGzContext(ctx context.Context, filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	data, err := FileGetBytesContext(ctx, filenameOrURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = WriteFull(data, writer)
-	if err != nil {
-		return err
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return BytesUnGzipErr(data, options...)
 	}
-	return writer.Close()
+	return BytesUnZlibErr(data, options...)
 }
 
-func FileGetGz(filenameOrURL string) ([]byte, error) {
-	data, err := FileGetBytes(filenameOrURL)
+// FileSetGz writes data zlib compressed, like FileSetZlib.
+func FileSetGz(filename string, data []byte, options ...FileWriteOptions) error {
+	return FileSetZlib(filename, data, options...)
+}
+
+// FileGetZlib returns the decompressed content of a zlib file.
+// The first optional options can limit the decompressed size, see BytesUnZlibErr.
+func FileGetZlib(filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	return FileGetZlibContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileGetZlibContext(ctx context.Context, filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	data, err := FileGetBytesContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
-	reader, err := zlib.NewReader(bytes.NewBuffer(data))
+	return BytesUnZlibErr(data, options...)
+}
+
+func FileSetZlib(filename string, data []byte, options ...FileWriteOptions) error {
+	return fileWriteCompressed(filename, FileZlib, data, options)
+}
+
+// FileGetLZW returns the decompressed content of a LZW file, see LZWPool.
+// The first optional options can limit the decompressed size, see BytesUnLZWErr.
+func FileGetLZW(filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	return FileGetLZWContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileGetLZWContext(ctx context.Context, filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	data, err := FileGetBytesContext(ctx, filenameOrURL)
 	if err != nil {
 		return nil, err
 	}
-	defer reader.Close()
-	return ioutil.ReadAll(reader)
+	return BytesUnLZWErr(data, options...)
 }
 
-func FileSetGz(filename string, data []byte) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	fileBuf := bufio.NewWriter(file)
-	defer fileBuf.Flush()
-	writer, err := zlib.NewWriterLevel(fileBuf, zlib.BestCompression)
-	if err != nil {
-		return err
-	}
-	_, err = WriteFull(data, writer)
-	if err != nil {
-		return err
-	}
-	return writer.Close()
+func FileSetLZW(filename string, data []byte, options ...FileWriteOptions) error {
+	return fileWriteCompressed(filename, FileLZW, data, options)
 }
 
 // FileSize returns the size of a file or zero in case of an error.
@@ -529,6 +623,8 @@ func FileScanf(filename, format string, args ...any) error {
 	return err
 }
 
+// ListDir returns the names of all entries of dir.
+// See FileWalk for recursive listings with filters.
 func ListDir(dir string) ([]string, error) {
 	f, err := os.Open(dir)
 	if err != nil {
@@ -601,40 +697,14 @@ func FileCopy(source string, dest string) (err error) {
 
 // FileCopyDir recursively copies a directory tree, attempting to preserve permissions.
 // Source directory must exist, destination directory must *not* exist.
-// Based on Jaybill McCarthy's code which can be found at http://jayblog.jaybill.com/post/id/26
+// Symlinks are followed. See FileCopyDirWithOptions for more control
+// and a detailed report.
 func FileCopyDir(source string, dest string) (err error) {
-	// get properties of source dir
-	fileInfo, err := os.Stat(source)
-	if err != nil {
-		return err
-	}
-	if !fileInfo.IsDir() {
-		return &FileCopyError{"Source is not a directory"}
-	}
-	// ensure dest dir does not already exist
-	_, err = os.Open(dest)
-	if !os.IsNotExist(err) {
-		return &FileCopyError{"Destination already exists"}
-	}
-	// create dest dir
-	err = os.MkdirAll(dest, fileInfo.Mode())
-	if err != nil {
-		return err
-	}
-	entries, err := ioutil.ReadDir(source)
-	for _, entry := range entries {
-		sourcePath := filepath.Join(source, entry.Name())
-		destinationPath := filepath.Join(dest, entry.Name())
-		if entry.IsDir() {
-			err = FileCopyDir(sourcePath, destinationPath)
-		} else {
-			// perform copy
-			err = FileCopy(sourcePath, destinationPath)
-		}
-		if err != nil {
-			return err
-		}
-	}
+	_, err = FileCopyDirWithOptions(source, dest, FileCopyOptions{
+		Conflict:      FileCopyFailIfExists,
+		Symlinks:      FileCopyFollowSymlinks,
+		PreserveModes: true,
+	})
 	return err
 }
 
@@ -6,10 +6,13 @@
 package dry
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -60,3 +63,38 @@ func Test_FileIsDir(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_FileGetBytesContext(t *testing.T) {
+	t.Run("canceled local file", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "testfile.txt")
+		require.NoError(t, ioutil.WriteFile(tempFile, make([]byte, 3*fileChunkSize), 0600))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := FileGetBytesContext(ctx, tempFile)
+		require.Equal(t, context.Canceled, err)
+
+		data, err := FileGetBytesContext(context.Background(), tempFile)
+		require.NoError(t, err)
+		require.Len(t, data, 3*fileChunkSize)
+	})
+
+	t.Run("http timeout", func(t *testing.T) {
+		release := make(chan null)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		_, err := FileGetString(server.URL, 50*time.Millisecond)
+		require.Error(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = FileGetLinesContext(ctx, server.URL)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build !windows
+
+package dry
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileChownLike changes the owner of file to the one of original.
+func fileChownLike(file *os.File, original os.FileInfo) error {
+	stat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return file.Chown(int(stat.Uid), int(stat.Gid))
+}
+
+// fileSyncDir flushes the directory entry of a renamed file to disk.
+func fileSyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
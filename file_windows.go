@@ -0,0 +1,23 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build windows
+
+package dry
+
+import (
+	"os"
+)
+
+func fileChownLike(file *os.File, original os.FileInfo) error {
+	// windows has no uid/gid, ACLs are inherited from the directory anyway
+	return nil
+}
+
+func fileSyncDir(dir string) error {
+	// directories can't be opened for syncing on windows,
+	// MoveFileEx used by os.Rename is already durable enough.
+	return nil
+}
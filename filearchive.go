@@ -0,0 +1,567 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileArchiveFormat is the file format used by FileArchiveDir and FileExtractArchive.
+type FileArchiveFormat int
+
+const (
+	// FileArchiveAuto uses the extension of the archive name, when extracting
+	// archives without known extension the format is detected from the content.
+	FileArchiveAuto FileArchiveFormat = iota
+	FileArchiveTar
+	FileArchiveTarGz
+	FileArchiveZip
+)
+
+// FileArchiveSymlinks decides how symbolic links are archived and extracted.
+type FileArchiveSymlinks int
+
+const (
+	// FileArchiveSkipSymlinks ignores links.
+	FileArchiveSkipSymlinks FileArchiveSymlinks = iota
+	// FileArchiveKeepSymlinks stores links as links. When extracting,
+	// links are only created if their target stays inside the destination directory.
+	FileArchiveKeepSymlinks
+	// FileArchiveFollowSymlinks archives the files and directories links point to.
+	// When extracting it is the same as FileArchiveKeepSymlinks.
+	FileArchiveFollowSymlinks
+)
+
+// ErrArchiveLimit is returned by FileExtractArchive if one of
+// the limits of FileArchiveOptions is exceeded.
+var ErrArchiveLimit = errors.New("archive limit exceeded")
+
+// FileArchiveOptions configures FileArchiveDir and FileExtractArchive.
+type FileArchiveOptions struct {
+	Format   FileArchiveFormat
+	Symlinks FileArchiveSymlinks
+	// Include limits files to those matching at least one of the filepath.Match
+	// patterns, see FileCopyOptions.Include.
+	Include []string
+	// Exclude skips files and whole directories matching one of the patterns.
+	Exclude []string
+	// MaxFileSize limits the extracted size of single files, no limit if zero.
+	MaxFileSize int64
+	// MaxTotalSize limits the extracted size of all files, no limit if zero.
+	MaxTotalSize int64
+	// MaxEntries limits the number of extracted entries, no limit if zero.
+	MaxEntries int
+	// Write is used for the archive file written by FileArchiveDir.
+	Write FileWriteOptions
+}
+
+func fileArchiveFormatOf(filename string, format FileArchiveFormat) FileArchiveFormat {
+	if format != FileArchiveAuto {
+		return format
+	}
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FileArchiveZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FileArchiveTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return FileArchiveTar
+	}
+	return FileArchiveAuto
+}
+
+// fileArchiveEntry is a file, directory or link to be archived.
+type fileArchiveEntry struct {
+	path   string // path on disk
+	name   string // slash separated name in the archive
+	info   os.FileInfo
+	target string // of a link
+}
+
+// FileArchiveDir packs the directory tree dir into the archive file archive.
+// The format is taken from options.Format or the archive extension:
+// .tar, .tar.gz, .tgz or .zip.
+// Entry names are relative to dir and use slashes.
+func FileArchiveDir(dir, archive string, options ...FileArchiveOptions) error {
+	var opts FileArchiveOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	format := fileArchiveFormatOf(archive, opts.Format)
+	if format == FileArchiveAuto {
+		return fmt.Errorf("unknown archive format of '%s'", archive)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	var entries []fileArchiveEntry
+	err = fileArchiveCollect(dir, "", &opts, make(map[string]bool), &entries)
+	if err != nil {
+		return err
+	}
+
+	return fileWrite(archive, []FileWriteOptions{opts.Write}, func(file io.Writer) error {
+		buffered := bufio.NewWriter(file)
+		var err error
+		switch format {
+		case FileArchiveZip:
+			err = fileWriteZip(buffered, entries)
+		case FileArchiveTarGz:
+			gzipWriter := Gzip.GetWriter(buffered)
+			err = fileWriteTar(gzipWriter, entries)
+			if err == nil {
+				err = gzipWriter.Close()
+			}
+			Gzip.ReturnWriter(gzipWriter)
+		default:
+			err = fileWriteTar(buffered, entries)
+		}
+		if err != nil {
+			return err
+		}
+		return buffered.Flush()
+	})
+}
+
+// fileArchiveCollect appends the entries below dir in sorted order.
+// visited holds the resolved paths of all directories to detect symlink loops.
+func fileArchiveCollect(dir, name string, opts *FileArchiveOptions, visited map[string]bool, entries *[]fileArchiveEntry) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if visited[resolved] {
+		return fmt.Errorf("symlink loop at '%s'", dir)
+	}
+	visited[resolved] = true
+	defer delete(visited, resolved)
+
+	children, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		entry := fileArchiveEntry{
+			path: filepath.Join(dir, child.Name()),
+			name: path.Join(name, child.Name()),
+			info: child,
+		}
+		if fileCopyMatches(opts.Exclude, entry.name) {
+			continue
+		}
+		if child.Mode()&os.ModeSymlink != 0 {
+			switch opts.Symlinks {
+			case FileArchiveSkipSymlinks:
+				continue
+			case FileArchiveKeepSymlinks:
+				if entry.target, err = os.Readlink(entry.path); err != nil {
+					return err
+				}
+				*entries = append(*entries, entry)
+				continue
+			}
+			if entry.info, err = os.Stat(entry.path); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case entry.info.IsDir():
+			*entries = append(*entries, entry)
+			err = fileArchiveCollect(entry.path, entry.name, opts, visited, entries)
+			if err != nil {
+				return err
+			}
+		case !entry.info.Mode().IsRegular():
+			// devices, sockets and pipes are not archived
+		case len(opts.Include) == 0 || fileCopyMatches(opts.Include, entry.name):
+			*entries = append(*entries, entry)
+		}
+	}
+	return nil
+}
+
+func fileWriteTar(w io.Writer, entries []fileArchiveEntry) error {
+	writer := tar.NewWriter(w)
+	for _, entry := range entries {
+		header, err := tar.FileInfoHeader(entry.info, entry.target)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.name
+		if entry.info.IsDir() {
+			header.Name += "/"
+		}
+		// user and group names are not portable between machines
+		header.Uname, header.Gname = "", ""
+		if err = writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.info.Mode().IsRegular() {
+			if err = fileCopyInto(writer, entry.path); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
+
+func fileWriteZip(w io.Writer, entries []fileArchiveEntry) error {
+	writer := zip.NewWriter(w)
+	writer.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestCompression)
+	})
+	for _, entry := range entries {
+		header, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.name
+		if entry.info.IsDir() {
+			header.Name += "/"
+		} else if entry.info.Mode().IsRegular() {
+			header.Method = zip.Deflate
+		}
+		content, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.target != "":
+			_, err = io.WriteString(content, entry.target)
+		case entry.info.Mode().IsRegular():
+			err = fileCopyInto(content, entry.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func fileCopyInto(w io.Writer, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// FileExtractArchive extracts the tar, tar.gz or zip file archive into dest.
+// Entries with absolute paths or paths leaving dest are rejected with an error,
+// as well as links pointing outside of dest. Links are created after all
+// other entries, so no file is ever written through a link from the archive.
+// Exceeding one of the limits of options returns an error wrapping ErrArchiveLimit.
+// Already extracted files are not removed in case of an error.
+func FileExtractArchive(archive, dest string, options ...FileArchiveOptions) error {
+	var opts FileArchiveOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format := fileArchiveFormatOf(archive, opts.Format)
+	if format == FileArchiveAuto {
+		header := make([]byte, 4)
+		n, _ := io.ReadFull(file, header)
+		switch {
+		case n == 4 && string(header) == "PK\x03\x04":
+			format = FileArchiveZip
+		case n >= 2 && header[0] == 0x1f && header[1] == 0x8b:
+			format = FileArchiveTarGz
+		default:
+			format = FileArchiveTar
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if err = os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	x := &fileExtractor{dest: dest, opts: &opts}
+	switch format {
+	case FileArchiveZip:
+		var info os.FileInfo
+		if info, err = file.Stat(); err == nil {
+			err = x.extractZip(file, info.Size())
+		}
+	case FileArchiveTarGz:
+		var reader io.ReadCloser
+		reader, err = fileDecompressor(FileGzip, bufio.NewReader(file))
+		if err == nil {
+			err = FirstError(x.extractTar(reader), reader.Close())
+		}
+	default:
+		err = x.extractTar(bufio.NewReader(file))
+	}
+	if err != nil {
+		return err
+	}
+	return x.createLinks()
+}
+
+type fileExtractor struct {
+	dest    string
+	opts    *FileArchiveOptions
+	entries int
+	total   int64
+	links   [][2]string // path and target
+}
+
+// path returns the destination path for an archive entry name
+// and if it should be extracted at all.
+func (x *fileExtractor) path(name string, isDir bool) (string, bool, error) {
+	x.entries++
+	if x.opts.MaxEntries > 0 && x.entries > x.opts.MaxEntries {
+		return "", false, fmt.Errorf("more than %d entries: %w", x.opts.MaxEntries, ErrArchiveLimit)
+	}
+
+	name = strings.Replace(name, "\\", "/", -1)
+	clean := path.Clean(name)
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false, fmt.Errorf("illegal path in archive: '%s'", name)
+	}
+	if clean == "." {
+		return "", false, nil
+	}
+	for dir := clean; dir != "."; dir = path.Dir(dir) {
+		if fileCopyMatches(x.opts.Exclude, dir) {
+			return "", false, nil
+		}
+	}
+	if !isDir && len(x.opts.Include) > 0 && !fileCopyMatches(x.opts.Include, clean) {
+		return "", false, nil
+	}
+	return filepath.Join(x.dest, filepath.FromSlash(clean)), true, nil
+}
+
+// link remembers a link to be created after all other entries.
+func (x *fileExtractor) link(linkPath, target string) error {
+	if x.opts.Symlinks == FileArchiveSkipSymlinks {
+		return nil
+	}
+	resolved := filepath.FromSlash(target)
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(linkPath), resolved)
+	}
+	rel, err := filepath.Rel(x.dest, resolved)
+	if err != nil || filepath.IsAbs(target) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("link '%s' points outside of destination: '%s'", linkPath, target)
+	}
+	x.links = append(x.links, [2]string{linkPath, target})
+	return nil
+}
+
+// createLinks creates the remembered links in order. Earlier links
+// can change where later ones resolve to, like "a -> ." followed by "a/b -> ..",
+// so every link is checked against the directory tree on disk, not as text.
+func (x *fileExtractor) createLinks() error {
+	var created []string
+	for _, link := range x.links {
+		rel, err := filepath.Rel(x.dest, link[0])
+		if err != nil {
+			return err
+		}
+		parent, err := PathSecureJoin(x.dest, filepath.Dir(rel))
+		if err != nil {
+			return fmt.Errorf("link '%s': %w", link[0], err)
+		}
+		// the target is resolved from the real parent, not joined lexically,
+		// because ".." after a link leaves the link target
+		target := filepath.FromSlash(link[1])
+		parentRel, err := filepath.Rel(x.destAbs(), parent)
+		if err == nil {
+			_, err = PathSecureJoin(x.dest, parentRel+string(filepath.Separator)+target)
+		}
+		if err != nil {
+			return fmt.Errorf("link '%s' points outside of destination: '%s'", link[0], link[1])
+		}
+
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+		linkPath := filepath.Join(parent, filepath.Base(link[0]))
+		if _, err := os.Lstat(linkPath); err == nil {
+			if err = os.Remove(linkPath); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(link[1], linkPath); err != nil {
+			return err
+		}
+		created = append(created, linkPath)
+	}
+	// a dangling link can be redirected by a link created after it
+	for _, linkPath := range created {
+		rel, err := filepath.Rel(x.destAbs(), linkPath)
+		if err == nil {
+			_, err = PathSecureJoin(x.dest, rel)
+		}
+		if err != nil {
+			os.Remove(linkPath)
+			return fmt.Errorf("link '%s': %w", linkPath, err)
+		}
+	}
+	return nil
+}
+
+// destAbs returns the absolute destination directory like PathSecureJoin uses it.
+func (x *fileExtractor) destAbs() string {
+	dest, err := filepath.Abs(x.dest)
+	if err != nil {
+		return x.dest
+	}
+	return dest
+}
+
+// writeFile copies at most the allowed number of bytes from r to filename.
+func (x *fileExtractor) writeFile(filename string, r io.Reader, mode os.FileMode) error {
+	limit := int64(-1)
+	if x.opts.MaxFileSize > 0 {
+		limit = x.opts.MaxFileSize
+	}
+	if x.opts.MaxTotalSize > 0 && (limit < 0 || x.opts.MaxTotalSize-x.total < limit) {
+		limit = x.opts.MaxTotalSize - x.total
+	}
+	if limit >= 0 {
+		// one more byte to detect exceeding the limit
+		r = io.LimitReader(r, limit+1)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	// an existing link must be replaced, not written through
+	if info, err := os.Lstat(filename); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err = os.Remove(filename); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(file, r)
+	if err = FirstError(err, file.Close()); err != nil {
+		return err
+	}
+	x.total += n
+	if limit >= 0 && n > limit {
+		os.Remove(filename)
+		return fmt.Errorf("'%s' exceeds size limit: %w", filename, ErrArchiveLimit)
+	}
+	return nil
+}
+
+func (x *fileExtractor) extractTar(r io.Reader) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		isDir := header.Typeflag == tar.TypeDir
+		filename, ok, err := x.path(header.Name, isDir)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(filename, os.FileMode(header.Mode).Perm()|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.writeFile(filename, reader, os.FileMode(header.Mode))
+			if err == nil && !header.ModTime.IsZero() {
+				err = os.Chtimes(filename, header.ModTime, header.ModTime)
+			}
+		case tar.TypeSymlink:
+			err = x.link(filename, header.Linkname)
+		default:
+			// hard links, devices and pipes are not extracted
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x *fileExtractor) extractZip(r io.ReaderAt, size int64) error {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		mode := file.Mode()
+		filename, ok, err := x.path(file.Name, mode.IsDir())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if mode.IsDir() {
+			if err = os.MkdirAll(filename, mode.Perm()|0700); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+		if mode&os.ModeSymlink != 0 {
+			var target []byte
+			target, err = ioutil.ReadAll(io.LimitReader(content, 4096))
+			if err == nil {
+				err = x.link(filename, string(target))
+			}
+		} else {
+			err = x.writeFile(filename, content, mode)
+			if err == nil && !file.Modified.IsZero() {
+				err = os.Chtimes(filename, file.Modified, file.Modified)
+			}
+		}
+		if err = FirstError(err, content.Close()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
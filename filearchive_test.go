@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileArchiveDir(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "sub", "skip"), 0755))
+	require.NoError(t, FileSetString(filepath.Join(source, "a.txt"), "a"))
+	require.NoError(t, FileSetString(filepath.Join(source, "b.log"), "b"))
+	require.NoError(t, FileSetString(filepath.Join(source, "sub", "c.txt"), strings.Repeat("c", 1000)))
+	require.NoError(t, FileSetString(filepath.Join(source, "sub", "skip", "d.txt"), "d"))
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Symlink("a.txt", filepath.Join(source, "sub", "link")))
+	}
+
+	for _, name := range []string{"out.tar", "out.tar.gz", "out.zip"} {
+		archive := filepath.Join(root, name)
+		require.NoError(t, FileArchiveDir(source, archive, FileArchiveOptions{
+			Symlinks: FileArchiveKeepSymlinks,
+			Exclude:  []string{"sub/skip", "*.log"},
+		}))
+
+		dest := filepath.Join(root, "dest-"+name)
+		require.NoError(t, FileExtractArchive(archive, dest, FileArchiveOptions{Symlinks: FileArchiveKeepSymlinks}), name)
+		str, err := FileGetString(filepath.Join(dest, "sub", "c.txt"))
+		require.NoError(t, err)
+		require.Equal(t, strings.Repeat("c", 1000), str, name)
+		require.True(t, FileExists(filepath.Join(dest, "a.txt")), name)
+		require.False(t, FileExists(filepath.Join(dest, "b.log")), name)
+		require.False(t, FileExists(filepath.Join(dest, "sub", "skip")), name)
+		if runtime.GOOS != "windows" {
+			target, err := os.Readlink(filepath.Join(dest, "sub", "link"))
+			require.NoError(t, err, name)
+			require.Equal(t, "a.txt", target)
+		}
+
+		err = FileExtractArchive(archive, filepath.Join(root, "limited-"+name), FileArchiveOptions{MaxTotalSize: 500})
+		require.True(t, errors.Is(err, ErrArchiveLimit), name)
+	}
+
+	// detected from the content
+	require.NoError(t, os.Rename(filepath.Join(root, "out.zip"), filepath.Join(root, "out.bin")))
+	require.NoError(t, FileExtractArchive(filepath.Join(root, "out.bin"), filepath.Join(root, "detected"), FileArchiveOptions{Include: []string{"c.txt"}}))
+	require.True(t, FileExists(filepath.Join(root, "detected", "sub", "c.txt")))
+	require.False(t, FileExists(filepath.Join(root, "detected", "a.txt")))
+}
+
+func Test_FileExtractArchiveZipSlip(t *testing.T) {
+	root := t.TempDir()
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	w, err := zipWriter.Create("../evil.txt")
+	require.NoError(t, err)
+	w.Write([]byte("evil"))
+	require.NoError(t, zipWriter.Close())
+	require.NoError(t, FileSetBytes(filepath.Join(root, "slip.zip"), buf.Bytes()))
+	err = FileExtractArchive(filepath.Join(root, "slip.zip"), filepath.Join(root, "dest"))
+	require.EqualError(t, err, "illegal path in archive: '../evil.txt'")
+	require.False(t, FileExists(filepath.Join(root, "evil.txt")))
+
+	buf.Reset()
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../outside"}))
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, FileSetBytes(filepath.Join(root, "link.tar"), buf.Bytes()))
+	err = FileExtractArchive(filepath.Join(root, "link.tar"), filepath.Join(root, "dest"), FileArchiveOptions{Symlinks: FileArchiveKeepSymlinks})
+	require.Error(t, err)
+	require.NoError(t, FileExtractArchive(filepath.Join(root, "link.tar"), filepath.Join(root, "dest")))
+}
+
+func Test_FileExtractArchiveChainedLinks(t *testing.T) {
+	root := t.TempDir()
+	writeTar := func(name string, headers ...*tar.Header) string {
+		var buf bytes.Buffer
+		tarWriter := tar.NewWriter(&buf)
+		for _, header := range headers {
+			require.NoError(t, tarWriter.WriteHeader(header))
+		}
+		require.NoError(t, tarWriter.Close())
+		filename := filepath.Join(root, name)
+		require.NoError(t, FileSetBytes(filename, buf.Bytes()))
+		return filename
+	}
+	keep := FileArchiveOptions{Symlinks: FileArchiveKeepSymlinks}
+
+	// every target is inside as text, but "a/b" is "b" in dest, so ".." leaves dest
+	archive := writeTar("chain.tar",
+		&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+		&tar.Header{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: ".."},
+	)
+	dest := filepath.Join(root, "chain")
+	require.Error(t, FileExtractArchive(archive, dest, keep))
+	_, err := os.Lstat(filepath.Join(dest, "b"))
+	require.True(t, os.IsNotExist(err), "%v", err)
+
+	// "d/l" is dangling when created and redirected by "d/x" afterwards
+	archive = writeTar("dangling.tar",
+		&tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "x/.."},
+		&tar.Header{Name: "d/x", Typeflag: tar.TypeSymlink, Linkname: ".."},
+	)
+	dest = filepath.Join(root, "dangling")
+	require.Error(t, FileExtractArchive(archive, dest, keep))
+	_, err = os.Lstat(filepath.Join(dest, "d", "l"))
+	require.True(t, os.IsNotExist(err), "%v", err)
+
+	// links through links inside of dest are fine
+	archive = writeTar("inside.tar",
+		&tar.Header{Name: "sub/file.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "alias", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+		&tar.Header{Name: "alias/link", Typeflag: tar.TypeSymlink, Linkname: "file.txt"},
+	)
+	dest = filepath.Join(root, "inside")
+	require.NoError(t, FileExtractArchive(archive, dest, keep))
+	require.True(t, FileExists(filepath.Join(dest, "sub", "link")))
+}
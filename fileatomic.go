@@ -0,0 +1,180 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileWriteOptions configures how FileSet* helpers write their files.
+// The zero value truncates and overwrites the destination in place.
+type FileWriteOptions struct {
+	// Atomic writes into a temporary file in the same directory,
+	// syncs it and renames it over the destination, so after a crash
+	// the file holds either the old or the new content, never a mix.
+	Atomic bool
+	// PreserveMode keeps the permission bits of an existing destination.
+	PreserveMode bool
+	// PreserveOwner keeps uid and gid of an existing destination.
+	// Changing the owner usually needs privileges, on windows it is ignored.
+	PreserveOwner bool
+	// Perm is used for newly created files (before umask), 0660 if zero.
+	Perm os.FileMode
+}
+
+// FileAtomic is a shortcut for the most common atomic write mode.
+var FileAtomic = FileWriteOptions{Atomic: true, PreserveMode: true}
+
+func (o FileWriteOptions) perm() os.FileMode {
+	if o.Perm == 0 {
+		return 0660
+	}
+	return o.Perm
+}
+
+func fileWriteOptions(options []FileWriteOptions) FileWriteOptions {
+	if len(options) > 0 {
+		return options[0]
+	}
+	return FileWriteOptions{}
+}
+
+// FileWriter creates a writer for filename according to the first optional options.
+// Data written to an atomic writer becomes visible only after a successful Close.
+func FileWriter(filename string, options ...FileWriteOptions) (io.WriteCloser, error) {
+	o := fileWriteOptions(options)
+	if o.Atomic {
+		return NewAtomicFileWriter(filename, o)
+	}
+	return os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, o.perm())
+}
+
+// fileWrite creates filename via FileWriter and calls write with it.
+// An atomic write is aborted if write fails.
+func fileWrite(filename string, options []FileWriteOptions, write func(io.Writer) error) error {
+	writer, err := FileWriter(filename, options...)
+	if err != nil {
+		return err
+	}
+	if err = write(writer); err != nil {
+		if atomic, ok := writer.(*AtomicFileWriter); ok {
+			atomic.Abort()
+		} else {
+			writer.Close()
+		}
+		return err
+	}
+	return writer.Close()
+}
+
+// AtomicFileWriter writes to a temporary file which replaces
+// the destination on Close.
+type AtomicFileWriter struct {
+	file     *os.File
+	filename string
+	options  FileWriteOptions
+	original os.FileInfo
+	done     bool
+}
+
+// NewAtomicFileWriter creates a temporary file next to filename.
+// The Atomic flag of the first optional options is implied.
+func NewAtomicFileWriter(filename string, options ...FileWriteOptions) (*AtomicFileWriter, error) {
+	o := fileWriteOptions(options)
+	o.Atomic = true
+
+	original, err := os.Stat(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if original != nil && original.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: errors.New("is a directory")}
+	}
+
+	dir, base := filepath.Split(filename)
+	var file *os.File
+	for i := 0; i < 10; i++ {
+		tmpName := filepath.Join(dir, "."+base+"."+RandomHexString(12)+".tmp")
+		file, err = os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, o.perm())
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &AtomicFileWriter{
+		file:     file,
+		filename: filename,
+		options:  o,
+		original: original,
+	}, nil
+}
+
+// Name returns the name of the temporary file.
+func (w *AtomicFileWriter) Name() string {
+	return w.file.Name()
+}
+
+func (w *AtomicFileWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close syncs the temporary file, applies the preserved mode and owner,
+// renames it to the destination and syncs the directory.
+// On error the temporary file is removed and the destination is untouched.
+func (w *AtomicFileWriter) Close() (err error) {
+	if w.done {
+		return os.ErrClosed
+	}
+	w.done = true
+	defer func() {
+		if err != nil {
+			os.Remove(w.file.Name())
+		}
+	}()
+
+	if err = w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if w.original != nil {
+		if w.options.PreserveMode {
+			if err = w.file.Chmod(w.original.Mode()); err != nil {
+				w.file.Close()
+				return err
+			}
+		}
+		if w.options.PreserveOwner {
+			if err = fileChownLike(w.file, w.original); err != nil {
+				w.file.Close()
+				return err
+			}
+		}
+	}
+	if err = w.file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(w.file.Name(), w.filename); err != nil {
+		return err
+	}
+	return fileSyncDir(filepath.Dir(w.filename))
+}
+
+// Abort removes the temporary file and leaves the destination untouched.
+// Calling Abort after Close has no effect.
+func (w *AtomicFileWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileSetAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "state.json")
+
+	require.NoError(t, FileSetJSON(filename, map[string]int{"a": 1}, FileAtomic))
+	var state map[string]int
+	require.NoError(t, FileUnmarshallJSON(filename, &state))
+	require.Equal(t, map[string]int{"a": 1}, state)
+
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Chmod(filename, 0604))
+	}
+	require.NoError(t, FileSetCSV(filename, [][]string{{"a", "b"}}, FileAtomic))
+	str, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "a,b\n", str)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filename)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0604), info.Mode().Perm())
+	}
+
+	writer, err := NewAtomicFileWriter(filename)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("half written"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Abort())
+
+	str, err = FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "a,b\n", str)
+
+	names, err := ListDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"state.json"}, names, "temporary files must be removed")
+}
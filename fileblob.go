@@ -0,0 +1,363 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBlobCorrupt is returned when the content of a blob
+// doesn't match its digest.
+var ErrBlobCorrupt = errors.New("blob content doesn't match digest")
+
+// BlobStoreOptions configures a BlobStore.
+type BlobStoreOptions struct {
+	// Algorithm used for digests, defaults to HashSHA256.
+	Algorithm HashAlgorithm
+	// Compress gzips new blobs. Blobs are readable independent
+	// of this option, so it can be changed for an existing store.
+	Compress bool
+	// ShardDepth is the number of directory levels named
+	// after two characters of the digest, defaults to 2.
+	ShardDepth int
+	// GCGracePeriod protects blobs younger than this duration from
+	// BlobStore.Collect, so blobs that are put but not yet
+	// referenced somewhere are not removed. Defaults to one hour.
+	GCGracePeriod time.Duration
+}
+
+/*
+BlobStore is a content addressable store of blobs in a local directory.
+A blob is stored once under the hex digest of its uncompressed content:
+
+	dir/objects/2c/f2/2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+
+Blobs are written atomically and verified while being read.
+Unreferenced blobs are removed by mark and sweep garbage collection, see Collect.
+Multiple BlobStores, also of different processes, can use the same directory.
+*/
+type BlobStore struct {
+	dir     string
+	options BlobStoreOptions
+}
+
+// NewBlobStore creates dir if it doesn't exist.
+func NewBlobStore(dir string, options ...BlobStoreOptions) (*BlobStore, error) {
+	s := &BlobStore{dir: dir}
+	if len(options) > 0 {
+		s.options = options[0]
+	}
+	if s.options.ShardDepth <= 0 {
+		s.options.ShardDepth = 2
+	}
+	if s.options.GCGracePeriod <= 0 {
+		s.options.GCGracePeriod = time.Hour
+	}
+	for _, sub := range []string{"objects", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0770); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Dir returns the directory of the store.
+func (s *BlobStore) Dir() string {
+	return s.dir
+}
+
+func (s *BlobStore) checkDigest(digest string) error {
+	size := s.options.Algorithm.New().Size()
+	if len(digest) != size*2 {
+		return fmt.Errorf("invalid %s digest '%s'", s.options.Algorithm, digest)
+	}
+	for _, c := range digest {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return fmt.Errorf("invalid %s digest '%s'", s.options.Algorithm, digest)
+		}
+	}
+	return nil
+}
+
+// path returns the filename of an uncompressed blob,
+// a compressed blob has an additional ".gz" extension.
+func (s *BlobStore) path(digest string) string {
+	parts := []string{s.dir, "objects"}
+	for i := 0; i < s.options.ShardDepth && (i+1)*2 < len(digest); i++ {
+		parts = append(parts, digest[i*2:i*2+2])
+	}
+	return filepath.Join(append(parts, digest)...)
+}
+
+// find returns the filename of an existing blob and if it is compressed.
+func (s *BlobStore) find(digest string) (filename string, compressed bool, err error) {
+	if err = s.checkDigest(digest); err != nil {
+		return "", false, err
+	}
+	filename = s.path(digest)
+	if _, err = os.Stat(filename); err == nil {
+		return filename, false, nil
+	}
+	if _, err := os.Stat(filename + ".gz"); err == nil {
+		return filename + ".gz", true, nil
+	}
+	return "", false, err
+}
+
+// Put stores the content of reader and returns its digest.
+// Putting an existing blob again doesn't change its content, but sets
+// its modification time to now, so it is protected from Collect
+// for GCGracePeriod like a new blob.
+func (s *BlobStore) Put(reader io.Reader) (digest string, err error) {
+	tmp, err := ioutil.TempFile(filepath.Join(s.dir, "tmp"), "put-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	h := s.options.Algorithm.New()
+	if s.options.Compress {
+		gzipWriter := Gzip.GetWriter(tmp)
+		_, err = io.Copy(io.MultiWriter(h, gzipWriter), reader)
+		if err == nil {
+			err = gzipWriter.Close()
+		}
+		Gzip.ReturnWriter(gzipWriter)
+	} else {
+		_, err = io.Copy(io.MultiWriter(h, tmp), reader)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	digest = hex.EncodeToString(h.Sum(nil))
+	if existing, _, err := s.find(digest); err == nil {
+		// renew the existing blob, so Collect treats it as just put
+		now := time.Now()
+		if err = os.Chtimes(existing, now, now); err == nil {
+			return digest, os.Remove(tmp.Name())
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// removed in the meantime, so store it again
+	}
+	filename := s.path(digest)
+	if s.options.Compress {
+		filename += ".gz"
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0770); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return "", err
+	}
+	return digest, fileSyncDir(filepath.Dir(filename))
+}
+
+// PutBytes stores data and returns its digest.
+func (s *BlobStore) PutBytes(data []byte) (digest string, err error) {
+	return s.Put(bytes.NewReader(data))
+}
+
+// Has reports if the blob exists.
+func (s *BlobStore) Has(digest string) bool {
+	_, _, err := s.find(digest)
+	return err == nil
+}
+
+// Get opens the blob for reading. Reading the end of a blob
+// that doesn't match its digest returns an error wrapping ErrBlobCorrupt.
+// A missing blob is reported as an error for which os.IsNotExist returns true.
+func (s *BlobStore) Get(digest string) (io.ReadCloser, error) {
+	filename, compressed, err := s.find(digest)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := &blobReader{file: file, reader: file, hash: s.options.Algorithm.New(), digest: digest}
+	if compressed {
+		r.gzip, err = gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("blob '%s': %w", digest, ErrBlobCorrupt)
+		}
+		r.reader = r.gzip
+	}
+	return r, nil
+}
+
+// GetBytes returns the verified content of the blob.
+func (s *BlobStore) GetBytes(digest string) ([]byte, error) {
+	reader, err := s.Get(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// Delete removes the blob, deleting a missing blob is no error.
+func (s *BlobStore) Delete(digest string) error {
+	if err := s.checkDigest(digest); err != nil {
+		return err
+	}
+	filename := s.path(digest)
+	var errs ErrorList
+	for _, name := range []string{filename, filename + ".gz"} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
+// Digests returns the sorted digests of all blobs.
+func (s *BlobStore) Digests() ([]string, error) {
+	var digests []string
+	err := filepath.Walk(filepath.Join(s.dir, "objects"), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			digest := strings.TrimSuffix(info.Name(), ".gz")
+			if s.checkDigest(digest) == nil {
+				digests = append(digests, digest)
+			}
+		}
+		return nil
+	})
+	sort.Strings(digests)
+	return digests, err
+}
+
+// Verify reads all blobs and returns an ErrorList
+// with an error for every corrupt blob.
+func (s *BlobStore) Verify() error {
+	digests, err := s.Digests()
+	if err != nil {
+		return err
+	}
+	var errs ErrorList
+	for _, digest := range digests {
+		reader, err := s.Get(digest)
+		if err == nil {
+			_, err = io.Copy(ioutil.Discard, reader)
+			reader.Close()
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
+// Collect is the sweep phase of a mark and sweep garbage collection.
+// It deletes all blobs not in live that are older than GCGracePeriod,
+// and returns their digests. Left over temporary files are removed too.
+// Blobs are judged by their modification time, which Put renews,
+// so everything put since GCGracePeriod before Collect started survives
+// even if it is not yet in live. GCGracePeriod must be longer than
+// the time between a Put and the blob becoming part of the live set.
+// Only a Put of an expired blob racing with its removal by Collect
+// can return before Collect removes the blob.
+// Example:
+//
+//	live := make(StringSet)
+//	for _, record := range records {
+//		live.Set(record.Digest)
+//	}
+//	removed, err := store.Collect(live)
+func (s *BlobStore) Collect(live StringSet) (removed []string, err error) {
+	deadline := time.Now().Add(-s.options.GCGracePeriod)
+	var errs ErrorList
+	err = filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if !info.Mode().IsRegular() || !info.ModTime().Before(deadline) {
+			return nil
+		}
+		if filepath.Base(filepath.Dir(p)) == "tmp" {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			return nil
+		}
+		digest := strings.TrimSuffix(info.Name(), ".gz")
+		if s.checkDigest(digest) != nil || live.Has(digest) {
+			return nil
+		}
+		// a Put since the walk started renews the blob
+		if info, err := os.Lstat(p); err != nil || !info.ModTime().Before(deadline) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			return nil
+		}
+		removed = append(removed, digest)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	sort.Strings(removed)
+	return removed, errs.Err()
+}
+
+// blobReader verifies the digest of a blob when the end is read.
+type blobReader struct {
+	file   *os.File
+	gzip   *gzip.Reader
+	reader io.Reader
+	hash   hash.Hash
+	digest string
+}
+
+func (r *blobReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.digest {
+		return n, fmt.Errorf("blob '%s': %w", r.digest, ErrBlobCorrupt)
+	}
+	if err != nil && err != io.EOF && r.gzip != nil {
+		// a damaged gzip stream is corruption as well
+		return n, fmt.Errorf("blob '%s': %w: %s", r.digest, ErrBlobCorrupt, err)
+	}
+	return n, err
+}
+
+func (r *blobReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobStore(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		store, err := NewBlobStore(dir, BlobStoreOptions{Compress: compress})
+		require.NoError(t, err)
+
+		digest, err := store.Put(strings.NewReader("hello"))
+		require.NoError(t, err)
+		require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", digest)
+		expectedFile := filepath.Join(dir, "objects", "2c", "f2", digest)
+		if compress {
+			expectedFile += ".gz"
+		}
+		require.True(t, FileExists(expectedFile))
+
+		again, err := store.PutBytes([]byte("hello"))
+		require.NoError(t, err)
+		require.Equal(t, digest, again)
+		require.True(t, store.Has(digest))
+
+		data, err := store.GetBytes(digest)
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(data))
+
+		digests, err := store.Digests()
+		require.NoError(t, err)
+		require.Equal(t, []string{digest}, digests)
+		require.NoError(t, store.Verify())
+
+		require.NoError(t, store.Delete(digest))
+		require.False(t, store.Has(digest))
+		_, err = store.Get(digest)
+		require.True(t, os.IsNotExist(err), "%v", err)
+		require.NoError(t, store.Delete(digest))
+	}
+}
+
+func TestBlobStoreInvalidDigest(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir())
+	require.NoError(t, err)
+	for _, digest := range []string{"", "../../etc/passwd", strings.Repeat("G", 64), strings.Repeat("a", 40)} {
+		_, err = store.Get(digest)
+		require.Error(t, err)
+		require.False(t, store.Has(digest))
+		require.Error(t, store.Delete(digest))
+	}
+}
+
+func TestBlobStoreCorrupt(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir())
+	require.NoError(t, err)
+	digest, err := store.PutBytes([]byte("original"))
+	require.NoError(t, err)
+	require.NoError(t, FileSetString(store.path(digest), "tampered"))
+
+	_, err = store.GetBytes(digest)
+	require.True(t, errors.Is(err, ErrBlobCorrupt), "%v", err)
+	require.Error(t, store.Verify())
+}
+
+func TestBlobStoreCollect(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir(), BlobStoreOptions{GCGracePeriod: time.Minute})
+	require.NoError(t, err)
+	keep, err := store.PutBytes([]byte("keep"))
+	require.NoError(t, err)
+	drop, err := store.PutBytes([]byte("drop"))
+	require.NoError(t, err)
+	young, err := store.PutBytes([]byte("young"))
+	require.NoError(t, err)
+
+	old := time.Now().Add(-time.Hour)
+	for _, digest := range []string{keep, drop} {
+		require.NoError(t, os.Chtimes(store.path(digest), old, old))
+	}
+	live := make(StringSet)
+	live.Set(keep)
+	removed, err := store.Collect(live)
+	require.NoError(t, err)
+	require.Equal(t, []string{drop}, removed)
+	require.True(t, store.Has(keep))
+	require.True(t, store.Has(young))
+	require.False(t, store.Has(drop))
+
+	// putting an old unreferenced blob again protects it
+	require.NoError(t, os.Chtimes(store.path(young), old, old))
+	again, err := store.PutBytes([]byte("young"))
+	require.NoError(t, err)
+	require.Equal(t, young, again)
+	removed, err = store.Collect(live)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+	require.True(t, store.Has(young))
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// FileCompression is a compression format detected by FileCompressionOf.
+type FileCompression int
+
+const (
+	FileUncompressed FileCompression = iota
+	FileGzip
+	FileZlib
+	FileDeflate
+	FileBzip2
+	// FileLZW is LSB ordered LZW with 8 bit literals as written
+	// by compress/lzw, not the format of the Unix compress tool.
+	FileLZW
+)
+
+// fileCodecFirst is the FileCompression of the first registered Codec,
+// the others follow in order of registration.
+const fileCodecFirst FileCompression = 100
+
+func (c FileCompression) String() string {
+	switch c {
+	case FileUncompressed:
+		return "uncompressed"
+	case FileGzip:
+		return "gzip"
+	case FileZlib:
+		return "zlib"
+	case FileDeflate:
+		return "deflate"
+	case FileBzip2:
+		return "bzip2"
+	case FileLZW:
+		return "lzw"
+	}
+	if codec := codecAt(int(c - fileCodecFirst)); codec != nil {
+		return codec.Name()
+	}
+	return fmt.Sprintf("FileCompression(%d)", int(c))
+}
+
+// fileSniffSize is the number of bytes FileCompressionOf needs
+// for reliable detection.
+const fileSniffSize = 512
+
+// fileCompressionByExt maps file extensions to compression formats.
+var fileCompressionByExt = map[string]FileCompression{
+	".gz":      FileGzip,
+	".tgz":     FileGzip,
+	".zz":      FileZlib,
+	".deflate": FileDeflate,
+	".bz2":     FileBzip2,
+	".lzw":     FileLZW,
+}
+
+// fileExt returns the lowercased extension of a filename or URL path.
+func fileExt(filenameOrURL string) string {
+	if i := strings.IndexAny(filenameOrURL, "?#"); i != -1 && fileSchemeOf(filenameOrURL) != "" {
+		filenameOrURL = filenameOrURL[:i]
+	}
+	return strings.ToLower(path.Ext(strings.Replace(filenameOrURL, "\\", "/", -1)))
+}
+
+/*
+FileCompressionOf detects the compression format of a file
+from the first bytes of its content, and filename if not empty.
+
+Gzip, zlib and bzip2 are detected by their magic bytes,
+zlib only if the header can be decoded.
+LZW and raw deflate streams have no header and are only detected
+by the .lzw and .deflate extensions, as random binary data
+too often decodes as deflate.
+Registered codecs implementing CodecFileFormat are detected
+by their magic bytes or extensions, see RegisterCodec.
+*/
+func FileCompressionOf(filename string, header []byte) FileCompression {
+	switch {
+	case len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b:
+		return FileGzip
+	case len(header) >= 4 && string(header[:3]) == "BZh" && header[3] >= '1' && header[3] <= '9':
+		return FileBzip2
+	case len(header) >= 2 && header[0]&0x0f == 8 && header[0]>>4 <= 7 &&
+		(uint16(header[0])<<8|uint16(header[1]))%31 == 0 && fileTrialDecode(FileZlib, header):
+		return FileZlib
+	}
+	if c, ok := fileCodecCompressionOf(filename, header); ok {
+		return c
+	}
+	if c := fileCompressionByExt[fileExt(filename)]; c == FileDeflate || c == FileLZW {
+		return c
+	}
+	return FileUncompressed
+}
+
+// fileCodecCompressionOf detects registered codecs implementing CodecFileFormat,
+// magic bytes take precedence over extensions.
+func fileCodecCompressionOf(filename string, header []byte) (FileCompression, bool) {
+	ext := fileExt(filename)
+	byExt := -1
+	for i, codec := range Codecs() {
+		format, ok := codec.(CodecFileFormat)
+		if !ok {
+			continue
+		}
+		if magic := format.Magic(); len(magic) > 0 && bytes.HasPrefix(header, magic) {
+			return fileCodecFirst + FileCompression(i), true
+		}
+		if byExt == -1 && ext != "" && StringInSlice(ext, format.Extensions()) {
+			byExt = i
+		}
+	}
+	if byExt != -1 {
+		return fileCodecFirst + FileCompression(byExt), true
+	}
+	return FileUncompressed, false
+}
+
+// fileTrialDecode reports if header decodes without errors.
+// The stream must either continue after header,
+// or end exactly at the end of header without trailing data.
+func fileTrialDecode(c FileCompression, header []byte) bool {
+	// bytes.Reader is an io.ByteReader, so the decoder doesn't read ahead
+	source := bytes.NewReader(header)
+	reader, err := fileDecompressor(c, source)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+	_, err = io.Copy(ioutil.Discard, reader)
+	return err == io.ErrUnexpectedEOF || err == nil && source.Len() == 0
+}
+
+func fileDecompressor(c FileCompression, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case FileGzip:
+		return gzip.NewReader(r)
+	case FileZlib:
+		return zlib.NewReader(r)
+	case FileDeflate:
+		return flate.NewReader(r), nil
+	case FileBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case FileLZW:
+		return lzw.NewReader(r, lzw.LSB, 8), nil
+	}
+	if codec := codecAt(int(c - fileCodecFirst)); codec != nil {
+		return codec.NewReader(r)
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+// NewDecompressReader detects the compression of r with FileCompressionOf
+// and returns a reader for the decompressed data.
+// filename is only used for the detection and may be empty.
+// Closing the returned reader does not close r.
+func NewDecompressReader(r io.Reader, filename string) (io.ReadCloser, FileCompression, error) {
+	buffered := bufio.NewReaderSize(r, fileSniffSize)
+	header, err := buffered.Peek(fileSniffSize)
+	if err != nil && err != io.EOF {
+		return nil, FileUncompressed, err
+	}
+	c := FileCompressionOf(filename, header)
+	reader, err := fileDecompressor(c, buffered)
+	if err != nil {
+		return nil, c, err
+	}
+	return reader, c, nil
+}
+
+type fileDecompressReadCloser struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (r *fileDecompressReadCloser) Close() error {
+	return FirstError(r.ReadCloser.Close(), r.source.Close())
+}
+
+// FileOpenDecompressed opens filenameOrURL like FileOpen
+// and transparently decompresses it, see FileCompressionOf.
+// The first optional timeout limits the whole operation until Close.
+func FileOpenDecompressed(filenameOrURL string, timeout ...time.Duration) (io.ReadCloser, error) {
+	ctx, cancel := fileTimeoutContext(timeout)
+	reader, err := FileOpenDecompressedContext(ctx, filenameOrURL)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelReadCloser{ReadCloser: reader, ctx: ctx, cancel: cancel}, nil
+}
+
+func FileOpenDecompressedContext(ctx context.Context, filenameOrURL string) (io.ReadCloser, error) {
+	file, err := FileOpenContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
+	}
+	reader, _, err := NewDecompressReader(file, filenameOrURL)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileDecompressReadCloser{ReadCloser: reader, source: file}, nil
+}
+
+// FileDecompressMaxSize is the default limit of the decompressed size
+// of FileGetDecompressed and the getters using it, as protection
+// against decompression bombs. Zero or negative values disable the limit.
+var FileDecompressMaxSize int64 = 256 << 20
+
+// FileGetDecompressed reads filenameOrURL completely
+// and transparently decompresses it, see FileCompressionOf.
+// The text and struct getters like FileGetString or FileGetJSON
+// use it, while FileGetBytes always returns the raw content.
+// Decompressing more than FileDecompressMaxSize bytes
+// returns an error wrapping ErrDecompressLimit.
+// The first optional timeout limits the whole operation.
+func FileGetDecompressed(filenameOrURL string, timeout ...time.Duration) ([]byte, error) {
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileGetDecompressedContext(ctx, filenameOrURL)
+}
+
+// FileGetDecompressedContext is like FileGetDecompressed,
+// the first optional options override FileDecompressMaxSize.
+func FileGetDecompressedContext(ctx context.Context, filenameOrURL string, options ...DecompressOptions) ([]byte, error) {
+	maxSize := FileDecompressMaxSize
+	if len(options) > 0 {
+		maxSize = options[0].MaxSize
+	}
+	data, err := FileGetBytesContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
+	}
+	header := data
+	if len(header) > fileSniffSize {
+		header = header[:fileSniffSize]
+	}
+	c := FileCompressionOf(filenameOrURL, header)
+	if c == FileUncompressed {
+		return data, nil
+	}
+	reader, err := fileDecompressor(c, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if maxSize <= 0 {
+		return fileReadAllContext(ctx, reader, int64(len(data))*4)
+	}
+	sizeHint := int64(len(data)) * 4
+	if sizeHint > maxSize {
+		sizeHint = maxSize
+	}
+	// one more byte to detect exceeding the limit
+	result, err := fileReadAllContext(ctx, io.LimitReader(reader, maxSize+1), sizeHint)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(result)) > maxSize {
+		return nil, fmt.Errorf("'%s': %w of %d bytes", filenameOrURL, ErrDecompressLimit, maxSize)
+	}
+	return result, nil
+}
+
+// FileSetCompressed writes data to filename compressed with the format
+// of its extension: .gz and .tgz as gzip, .zz as zlib, .deflate as raw deflate,
+// .lzw as LZW, and the extensions of registered codecs implementing CodecFileFormat.
+// Other extensions are written uncompressed,
+// .bz2 returns an error because there is no bzip2 writer.
+func FileSetCompressed(filename string, data []byte, options ...FileWriteOptions) error {
+	c, ok := fileCompressionByExt[fileExt(filename)]
+	if !ok {
+		c, _ = fileCodecCompressionOf(filename, nil)
+	}
+	if c == FileBzip2 {
+		return fmt.Errorf("can't write %s compressed file '%s'", c, filename)
+	}
+	return fileWriteCompressed(filename, c, data, options)
+}
+
+// fileWriteCompressed writes data compressed with c using the pools.
+func fileWriteCompressed(filename string, c FileCompression, data []byte, options []FileWriteOptions) error {
+	return fileWrite(filename, options, func(file io.Writer) error {
+		fileBuf := bufio.NewWriter(file)
+		var writer io.WriteCloser
+		switch c {
+		case FileGzip:
+			gzipWriter := Gzip.GetWriter(fileBuf)
+			defer Gzip.ReturnWriter(gzipWriter)
+			writer = gzipWriter
+		case FileDeflate:
+			deflateWriter := Deflate.GetWriter(fileBuf)
+			defer Deflate.ReturnWriter(deflateWriter)
+			writer = deflateWriter
+		case FileZlib:
+			zlibWriter := Zlib.GetWriter(fileBuf)
+			defer Zlib.ReturnWriter(zlibWriter)
+			writer = zlibWriter
+		case FileLZW:
+			lzwWriter := LZW.GetWriter(fileBuf)
+			defer LZW.ReturnWriter(lzwWriter)
+			writer = lzwWriter
+		default:
+			codec := codecAt(int(c - fileCodecFirst))
+			if codec == nil {
+				if _, err := WriteFull(data, fileBuf); err != nil {
+					return err
+				}
+				return fileBuf.Flush()
+			}
+			codecWriter, err := codec.NewWriter(fileBuf)
+			if err != nil {
+				return err
+			}
+			writer = codecWriter
+		}
+		if _, err := WriteFull(data, writer); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		return fileBuf.Flush()
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileCompressionOf(t *testing.T) {
+	text := []byte(strings.Repeat("x^ plain text that is not zlib\n", 30))
+	require.Equal(t, FileUncompressed, FileCompressionOf("", text))
+	require.Equal(t, FileUncompressed, FileCompressionOf("", nil))
+	require.Equal(t, FileGzip, FileCompressionOf("", BytesGzip(text)))
+	require.Equal(t, FileUncompressed, FileCompressionOf("", BytesDeflate(text)), "raw deflate only by extension")
+	require.Equal(t, FileDeflate, FileCompressionOf("file.deflate", text))
+	require.Equal(t, FileLZW, FileCompressionOf("http://host/file.LZW?x=1", text))
+	require.Equal(t, FileBzip2, FileCompressionOf("", []byte("BZh91AY&SY")))
+	require.Equal(t, "zlib", FileZlib.String())
+}
+
+func Test_FileSetCompressed(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat(`{"key": "value"}`, 100)
+	for _, ext := range []string{".gz", ".zz", ".deflate", ".lzw", ".json"} {
+		filename := filepath.Join(dir, "data"+ext)
+		require.NoError(t, FileSetCompressed(filename, []byte(content)))
+		if ext != ".json" {
+			require.Less(t, FileSize(filename), int64(len(content)), ext)
+		}
+
+		str, err := FileGetString(filename)
+		require.NoError(t, err, ext)
+		require.Equal(t, content, str, ext)
+
+		reader, err := FileOpenDecompressed(filename)
+		require.NoError(t, err, ext)
+		data, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, content, string(data), ext)
+	}
+
+	raw, err := FileGetBytes(filepath.Join(dir, "data.gz"))
+	require.NoError(t, err)
+	require.Equal(t, FileGzip, FileCompressionOf("", raw))
+
+	require.Error(t, FileSetCompressed(filepath.Join(dir, "data.bz2"), []byte(content)))
+}
+
+func Test_FileCompressionOfBinary(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, fileSniffSize)
+		random.Read(data)
+		require.Equal(t, FileUncompressed, FileCompressionOf("", data), "%x", data)
+	}
+
+	// a complete zlib stream followed by other data is no zlib file
+	data := append(BytesZlib([]byte("x")), "trailing data"...)
+	require.Equal(t, FileUncompressed, FileCompressionOf("", data))
+	require.Equal(t, FileZlib, FileCompressionOf("", BytesZlib([]byte("x"))))
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.bin")
+	require.NoError(t, FileSetBytes(filename, data))
+	str, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, string(data), str)
+}
+
+func Test_FileGetDecompressedLimit(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("0", 10000)
+	filename := filepath.Join(dir, "data.gz")
+	require.NoError(t, FileSetCompressed(filename, []byte(content)))
+
+	_, err := FileGetDecompressedContext(context.Background(), filename, DecompressOptions{MaxSize: 9999})
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+	data, err := FileGetDecompressedContext(context.Background(), filename, DecompressOptions{MaxSize: 10000})
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	defer func(maxSize int64) { FileDecompressMaxSize = maxSize }(FileDecompressMaxSize)
+	FileDecompressMaxSize = 100
+	_, err = FileGetString(filename)
+	require.True(t, errors.Is(err, ErrDecompressLimit), "%v", err)
+	// uncompressed files are not limited
+	require.NoError(t, FileSetString(filepath.Join(dir, "data.txt"), content))
+	str, err := FileGetString(filepath.Join(dir, "data.txt"))
+	require.NoError(t, err)
+	require.Equal(t, content, str)
+
+	// iterators stream decompressed data without limit
+	require.NoError(t, FileSetCompressed(filepath.Join(dir, "lines.gz"), []byte("a\nb\n"+content)))
+	lines, err := FileIterateLines(filepath.Join(dir, "lines.gz"))
+	require.NoError(t, err)
+	defer lines.Close()
+	var result []string
+	for lines.Next() {
+		result = append(result, lines.Line())
+	}
+	require.NoError(t, lines.Err())
+	require.Equal(t, []string{"a", "b", content}, result)
+}
@@ -0,0 +1,442 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileCopyConflict decides what happens with already existing destinations.
+type FileCopyConflict int
+
+const (
+	// FileCopyFailIfExists refuses to copy into an existing destination directory.
+	FileCopyFailIfExists FileCopyConflict = iota
+	// FileCopyOverwrite merges directories and replaces existing files.
+	FileCopyOverwrite
+	// FileCopySkipExisting merges directories and keeps existing files.
+	FileCopySkipExisting
+	// FileCopyMerge merges directories and replaces existing files
+	// only if the source was modified later.
+	FileCopyMerge
+)
+
+// FileCopySymlinks decides how symbolic links in the source tree are handled.
+type FileCopySymlinks int
+
+const (
+	// FileCopyFollowSymlinks copies the files and directories links point to.
+	// Links forming a loop are reported as failed.
+	FileCopyFollowSymlinks FileCopySymlinks = iota
+	// FileCopyRecreateSymlinks creates links with the same target in the destination.
+	FileCopyRecreateSymlinks
+	// FileCopySkipSymlinks ignores links.
+	FileCopySkipSymlinks
+)
+
+// FileCopyOptions configures FileCopyDirWithOptions.
+type FileCopyOptions struct {
+	Conflict FileCopyConflict
+	Symlinks FileCopySymlinks
+	// Include limits copied files to those matching at least one of the
+	// filepath.Match patterns. Patterns are matched against the slash separated
+	// path relative to the source directory and against the base name.
+	// Directories are always traversed.
+	Include []string
+	// Exclude skips files and whole directories matching one of the patterns.
+	Exclude []string
+	// PreserveModes copies the permission bits.
+	PreserveModes bool
+	// PreserveTimes copies modification times, also of directories.
+	PreserveTimes bool
+	// Workers is the number of files copied in parallel, 1 if zero.
+	Workers int
+	// Progress is called after each entry was handled. Calls are serialized.
+	Progress func(entry FileCopyEntry)
+	// DryRun only reports what would be done.
+	DryRun bool
+}
+
+// FileCopyEntryStatus is the result of copying a single entry.
+type FileCopyEntryStatus int
+
+const (
+	FileCopied FileCopyEntryStatus = iota
+	FileCopySkipped
+	FileCopyFailed
+)
+
+// FileCopyEntry describes a single file, directory or link handled by FileCopyDirWithOptions.
+type FileCopyEntry struct {
+	Source string
+	Dest   string
+	Size   int64
+	IsDir  bool
+	Status FileCopyEntryStatus
+	// Reason explains why an entry was skipped.
+	Reason string
+	// Err is set for failed entries.
+	Err error
+}
+
+// FileCopyReport lists all entries handled by FileCopyDirWithOptions.
+type FileCopyReport struct {
+	Copied  []FileCopyEntry
+	Skipped []FileCopyEntry
+	Failed  []FileCopyEntry
+	// Bytes is the total size of all copied files.
+	Bytes int64
+
+	mutex    sync.Mutex
+	progress func(FileCopyEntry)
+}
+
+// Err returns an ErrorList with the errors of all failed entries,
+// or nil if nothing failed.
+func (report *FileCopyReport) Err() error {
+	var list ErrorList
+	for _, entry := range report.Failed {
+		list = append(list, entry.Err)
+	}
+	return list.Err()
+}
+
+func (report *FileCopyReport) add(entry FileCopyEntry) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+	switch entry.Status {
+	case FileCopied:
+		report.Copied = append(report.Copied, entry)
+		if !entry.IsDir {
+			report.Bytes += entry.Size
+		}
+	case FileCopySkipped:
+		report.Skipped = append(report.Skipped, entry)
+	default:
+		report.Failed = append(report.Failed, entry)
+	}
+	if report.progress != nil {
+		report.progress(entry)
+	}
+}
+
+// FileCopyDirWithOptions recursively copies the directory tree source to dest.
+// Problems with single entries don't stop the copy, they are listed in
+// report.Failed and returned together as ErrorList.
+// A *FileCopyError is returned if the copy can't start at all.
+func FileCopyDirWithOptions(source, dest string, options FileCopyOptions) (report *FileCopyReport, err error) {
+	report = &FileCopyReport{progress: options.Progress}
+	info, err := os.Stat(source)
+	if err != nil {
+		return report, err
+	}
+	if !info.IsDir() {
+		return report, &FileCopyError{"Source is not a directory"}
+	}
+	if _, err = os.Lstat(dest); !os.IsNotExist(err) && options.Conflict == FileCopyFailIfExists {
+		return report, &FileCopyError{"Destination already exists"}
+	}
+	// the copy would be copied again and again
+	inside, err := fileCopyDestInside(source, dest)
+	if err != nil {
+		return report, err
+	}
+	if inside {
+		return report, &FileCopyError{"Destination is inside the source"}
+	}
+
+	workers := options.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	c := &fileCopier{
+		options: options,
+		report:  report,
+		jobs:    make(chan FileCopyEntry),
+		visited: make(map[string]bool),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range c.jobs {
+				report.add(c.copyFile(entry))
+			}
+		}()
+	}
+
+	c.copyDir(source, dest, "", info)
+	close(c.jobs)
+	wg.Wait()
+
+	// writing files changes the times of their directory and read only
+	// directories can't be filled, so directory attributes are set last
+	if !options.DryRun && (options.PreserveModes || options.PreserveTimes) {
+		for i := len(c.dirs) - 1; i >= 0; i-- {
+			dir := c.dirs[i]
+			var err error
+			if options.PreserveModes {
+				err = os.Chmod(dir.Dest, dir.info.Mode().Perm())
+			}
+			if err == nil && options.PreserveTimes {
+				err = os.Chtimes(dir.Dest, dir.info.ModTime(), dir.info.ModTime())
+			}
+			if err != nil {
+				report.add(FileCopyEntry{Source: dir.Source, Dest: dir.Dest, IsDir: true, Status: FileCopyFailed, Err: err})
+			}
+		}
+	}
+	return report, report.Err()
+}
+
+// fileCopyDestInside reports if dest is source or below it
+// after resolving symlinks. dest doesn't need to exist.
+func fileCopyDestInside(source, dest string) (bool, error) {
+	resolvedSource, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return false, err
+	}
+	resolvedSource, err = filepath.Abs(resolvedSource)
+	if err != nil {
+		return false, err
+	}
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return false, err
+	}
+	resolvedDest := dest
+	if nearest := PathNearestExisting(dest); nearest != "" {
+		if resolvedDest, err = filepath.EvalSymlinks(nearest); err != nil {
+			return false, err
+		}
+		missing, _ := filepath.Rel(nearest, dest)
+		resolvedDest = filepath.Join(resolvedDest, missing)
+	}
+	rel, err := filepath.Rel(resolvedSource, resolvedDest)
+	if err != nil {
+		// different volumes on windows
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+type fileCopier struct {
+	options FileCopyOptions
+	report  *FileCopyReport
+	jobs    chan FileCopyEntry
+	// visited holds the resolved paths of the directories
+	// currently being copied to detect symlink loops
+	visited map[string]bool
+	dirs    []fileCopyDir
+}
+
+type fileCopyDir struct {
+	FileCopyEntry
+	info os.FileInfo
+}
+
+// fileCopyMatches reports if relPath or its base name matches one of patterns.
+func fileCopyMatches(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *fileCopier) copyDir(source, dest, relPath string, info os.FileInfo) {
+	entry := FileCopyEntry{Source: source, Dest: dest, IsDir: true}
+	fail := func(err error) {
+		entry.Status = FileCopyFailed
+		entry.Err = err
+		c.report.add(entry)
+	}
+
+	resolved, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if c.visited[resolved] {
+		fail(&FileCopyError{"Symlink loop at " + source})
+		return
+	}
+	c.visited[resolved] = true
+	defer delete(c.visited, resolved)
+
+	entries, err := ioutil.ReadDir(source)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if !c.options.DryRun {
+		// owner must be able to fill the directory, the mode is fixed at the end
+		if err = os.MkdirAll(dest, info.Mode().Perm()|0700); err != nil {
+			fail(err)
+			return
+		}
+	}
+	c.report.add(entry)
+	c.dirs = append(c.dirs, fileCopyDir{entry, info})
+	for _, child := range entries {
+		childSource := filepath.Join(source, child.Name())
+		childDest := filepath.Join(dest, child.Name())
+		childRel := filepath.ToSlash(filepath.Join(relPath, child.Name()))
+		childEntry := FileCopyEntry{Source: childSource, Dest: childDest, Size: child.Size(), IsDir: child.IsDir()}
+
+		if fileCopyMatches(c.options.Exclude, childRel) {
+			childEntry.Status, childEntry.Reason = FileCopySkipped, "excluded"
+			c.report.add(childEntry)
+			continue
+		}
+
+		if child.Mode()&os.ModeSymlink != 0 {
+			switch c.options.Symlinks {
+			case FileCopySkipSymlinks:
+				childEntry.Status, childEntry.Reason = FileCopySkipped, "symlink"
+				c.report.add(childEntry)
+				continue
+			case FileCopyRecreateSymlinks:
+				childEntry.Size = 0
+				c.report.add(c.copySymlink(childEntry))
+				continue
+			}
+			target, err := os.Stat(childSource)
+			if err != nil {
+				childEntry.Status, childEntry.Err = FileCopyFailed, err
+				c.report.add(childEntry)
+				continue
+			}
+			child = target
+			childEntry.Size, childEntry.IsDir = child.Size(), child.IsDir()
+		}
+
+		switch {
+		case child.IsDir():
+			c.copyDir(childSource, childDest, childRel, child)
+		case !child.Mode().IsRegular():
+			childEntry.Status, childEntry.Reason = FileCopySkipped, "not a regular file"
+			c.report.add(childEntry)
+		case len(c.options.Include) > 0 && !fileCopyMatches(c.options.Include, childRel):
+			childEntry.Status, childEntry.Reason = FileCopySkipped, "not included"
+			c.report.add(childEntry)
+		default:
+			c.jobs <- childEntry
+		}
+	}
+}
+
+// conflict returns a skip reason if entry must not be written.
+func (c *fileCopier) conflict(entry FileCopyEntry) (reason string, err error) {
+	destInfo, err := os.Lstat(entry.Dest)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch c.options.Conflict {
+	case FileCopySkipExisting:
+		return "exists", nil
+	case FileCopyMerge:
+		sourceInfo, err := os.Stat(entry.Source)
+		if err != nil {
+			return "", err
+		}
+		if !sourceInfo.ModTime().After(destInfo.ModTime()) {
+			return "not newer", nil
+		}
+	}
+	return "", nil
+}
+
+func (c *fileCopier) copyFile(entry FileCopyEntry) FileCopyEntry {
+	reason, err := c.conflict(entry)
+	if err == nil && reason == "" && !c.options.DryRun {
+		err = c.writeFile(entry.Source, entry.Dest)
+	}
+	switch {
+	case err != nil:
+		entry.Status, entry.Err = FileCopyFailed, err
+	case reason != "":
+		entry.Status, entry.Reason = FileCopySkipped, reason
+	default:
+		entry.Status = FileCopied
+	}
+	return entry
+}
+
+func (c *fileCopier) writeFile(source, dest string) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	// an existing link must be replaced, not written through
+	if destInfo, err := os.Lstat(dest); err == nil && destInfo.Mode()&os.ModeSymlink != 0 {
+		if err = os.Remove(dest); err != nil {
+			return err
+		}
+	}
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destFile, sourceFile)
+	if err = FirstError(err, destFile.Close()); err != nil {
+		return err
+	}
+	if c.options.PreserveModes {
+		if err = os.Chmod(dest, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if c.options.PreserveTimes {
+		return os.Chtimes(dest, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+func (c *fileCopier) copySymlink(entry FileCopyEntry) FileCopyEntry {
+	target, err := os.Readlink(entry.Source)
+	if err == nil {
+		var reason string
+		reason, err = c.conflict(entry)
+		if err == nil && reason != "" {
+			entry.Status, entry.Reason = FileCopySkipped, reason
+			return entry
+		}
+	}
+	if err == nil && !c.options.DryRun {
+		if _, lerr := os.Lstat(entry.Dest); lerr == nil {
+			err = os.Remove(entry.Dest)
+		}
+		if err == nil {
+			err = os.Symlink(target, entry.Dest)
+		}
+	}
+	if err != nil {
+		entry.Status, entry.Err = FileCopyFailed, err
+	} else {
+		entry.Status = FileCopied
+	}
+	return entry
+}
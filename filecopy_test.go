@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileCopyDirWithOptions(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "sub", "skip"), 0755))
+	require.NoError(t, FileSetString(filepath.Join(source, "a.txt"), "a"))
+	require.NoError(t, FileSetString(filepath.Join(source, "b.log"), "b"))
+	require.NoError(t, FileSetString(filepath.Join(source, "sub", "c.txt"), "c"))
+	require.NoError(t, FileSetString(filepath.Join(source, "sub", "skip", "d.txt"), "d"))
+	old := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(source, "a.txt"), old, old))
+
+	require.NoError(t, FileCopyDir(source, dest))
+	require.Error(t, FileCopyDir(source, dest))
+
+	require.NoError(t, os.RemoveAll(dest))
+	var progress int
+	report, err := FileCopyDirWithOptions(source, dest, FileCopyOptions{
+		Include:       []string{"*.txt"},
+		Exclude:       []string{"sub/skip"},
+		PreserveTimes: true,
+		Workers:       4,
+		Progress:      func(FileCopyEntry) { progress++ },
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Copied, 4) // source, sub, a.txt, c.txt
+	require.Len(t, report.Skipped, 2)
+	require.Equal(t, int64(2), report.Bytes)
+	require.Equal(t, 6, progress)
+	require.False(t, FileExists(filepath.Join(dest, "b.log")))
+	require.False(t, FileExists(filepath.Join(dest, "sub", "skip")))
+	require.True(t, FileTimeModified(filepath.Join(dest, "a.txt")).Equal(old))
+
+	require.NoError(t, FileSetString(filepath.Join(dest, "a.txt"), "changed"))
+	report, err = FileCopyDirWithOptions(source, dest, FileCopyOptions{Conflict: FileCopyMerge, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, "not newer", report.Skipped[0].Reason)
+
+	report, err = FileCopyDirWithOptions(source, dest, FileCopyOptions{Conflict: FileCopyOverwrite})
+	require.NoError(t, err)
+	str, err := FileGetString(filepath.Join(dest, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "a", str)
+
+	// copying into the source itself would never end
+	for _, conflict := range []FileCopyConflict{FileCopyFailIfExists, FileCopyOverwrite, FileCopySkipExisting, FileCopyMerge} {
+		_, err = FileCopyDirWithOptions(source, filepath.Join(source, "sub", "copy"), FileCopyOptions{Conflict: conflict})
+		require.IsType(t, &FileCopyError{}, err)
+	}
+	_, err = FileCopyDirWithOptions(source, source, FileCopyOptions{Conflict: FileCopyOverwrite})
+	require.IsType(t, &FileCopyError{}, err)
+	require.False(t, FileExists(filepath.Join(source, "sub", "copy")))
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// also through a symlink to the source
+	require.NoError(t, os.Symlink(source, filepath.Join(root, "source-link")))
+	_, err = FileCopyDirWithOptions(source, filepath.Join(root, "source-link", "copy"), FileCopyOptions{Conflict: FileCopyMerge})
+	require.IsType(t, &FileCopyError{}, err)
+	require.NoError(t, os.Remove(filepath.Join(root, "source-link")))
+
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(source, "link")))
+	require.NoError(t, os.Symlink("..", filepath.Join(source, "sub", "loop")))
+	report, err = FileCopyDirWithOptions(source, dest, FileCopyOptions{Conflict: FileCopySkipExisting, Symlinks: FileCopyRecreateSymlinks})
+	require.NoError(t, err)
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	require.NoError(t, err)
+	require.Equal(t, "a.txt", target)
+
+	report, err = FileCopyDirWithOptions(source, filepath.Join(root, "followed"), FileCopyOptions{})
+	require.Error(t, err)
+	require.Len(t, report.Failed, 1)
+	require.Equal(t, filepath.Join(source, "sub", "loop"), report.Failed[0].Source)
+
+	// a link to a directory copied before is no loop
+	require.NoError(t, os.Remove(filepath.Join(source, "sub", "loop")))
+	require.NoError(t, os.Symlink("sub", filepath.Join(source, "alias")))
+	followed := filepath.Join(root, "alias")
+	require.NoError(t, FileCopyDir(source, followed))
+	str, err = FileGetString(filepath.Join(followed, "alias", "c.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "c", str)
+	require.True(t, FileExists(filepath.Join(followed, "sub", "c.txt")))
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// FileCSVColumnPolicy decides what happens if the CSV header
+// and the struct fields don't match.
+type FileCSVColumnPolicy int
+
+const (
+	// FileCSVIgnoreColumns ignores columns without struct field
+	// or leaves struct fields without column at their zero value.
+	FileCSVIgnoreColumns FileCSVColumnPolicy = iota
+	// FileCSVErrorOnColumns returns an error.
+	FileCSVErrorOnColumns
+)
+
+// FileCSVOptions configures FileUnmarshallCSV and FileMarshalCSV.
+type FileCSVOptions struct {
+	// Comma is the field delimiter, ',' if zero.
+	Comma rune
+	// Comment starts lines that are ignored when reading, none if zero.
+	Comment rune
+	// MissingColumns is the policy for struct fields without header column.
+	MissingColumns FileCSVColumnPolicy
+	// ExtraColumns is the policy for header columns without struct field.
+	ExtraColumns FileCSVColumnPolicy
+	// ContinueOnError keeps reading after rows that can't be converted
+	// or have a different number of fields than the header,
+	// and returns the errors of all those rows as ErrorList.
+	// Rows with errors are not added to the result.
+	// Malformed CSV like unterminated quotes still stops reading.
+	ContinueOnError bool
+	// Write is used by FileMarshalCSV.
+	Write FileWriteOptions
+}
+
+func (o *FileCSVOptions) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+	return o.Comma
+}
+
+// FileCSVRowError describes a value that could not be converted
+// to its struct field.
+type FileCSVRowError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+func (e *FileCSVRowError) Error() string {
+	return fmt.Sprintf("line %d, column '%s': %s", e.Line, e.Column, e.Err)
+}
+
+func (e *FileCSVRowError) Unwrap() error {
+	return e.Err
+}
+
+// csvField is a struct field mapped to a CSV column.
+type csvField struct {
+	column string
+	index  []int
+}
+
+/*
+csvStructFields returns the exported fields of structType in declaration order.
+The column name is taken from the `csv` struct tag or is the field name.
+Fields tagged with `csv:"-"` are skipped, anonymous sub-structs are inlined.
+Example:
+	type Row struct {
+		ID    int    `csv:"id"`
+		Name  string `csv:"name"`
+		Cache string `csv:"-"`
+	}
+*/
+func csvStructFields(structType reflect.Type, parentIndex []int) []csvField {
+	var fields []csvField
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		index := append(append([]int(nil), parentIndex...), i)
+		column, _ := StringSplitOnceChar(structField.Tag.Get("csv"), ',')
+		if column == "-" {
+			continue
+		}
+		// exported fields of unexported embedded structs are promoted
+		if structField.Anonymous && structField.Type.Kind() == reflect.Struct && column == "" {
+			fields = append(fields, csvStructFields(structField.Type, index)...)
+			continue
+		}
+		if !ReflectStructFieldIsExported(structField) {
+			continue
+		}
+		if column == "" {
+			column = structField.Name
+		}
+		fields = append(fields, csvField{column: column, index: index})
+	}
+	return fields
+}
+
+// csvSliceElem returns the struct type of a slice of structs or struct pointers.
+func csvSliceElem(sliceType reflect.Type) (structType reflect.Type, isPtr bool, err error) {
+	if sliceType.Kind() != reflect.Slice {
+		return nil, false, fmt.Errorf("expected a slice of structs, but got %s", sliceType)
+	}
+	structType = sliceType.Elem()
+	if structType.Kind() == reflect.Ptr {
+		structType, isPtr = structType.Elem(), true
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil, false, fmt.Errorf("expected a slice of structs, but got %s", sliceType)
+	}
+	return structType, isPtr, nil
+}
+
+// FileUnmarshallCSV reads the CSV file filenameOrURL into slicePtr,
+// which must be a pointer to a slice of structs or struct pointers.
+// The first record is the header, its column names are mapped
+// to struct fields by their `csv` tag or name.
+// Values are converted like with ReflectSetStructFieldsFromStringMap,
+// empty values leave non string fields at their zero value.
+func FileUnmarshallCSV(filenameOrURL string, slicePtr any, options ...FileCSVOptions) error {
+	return FileUnmarshallCSVContext(context.Background(), filenameOrURL, slicePtr, options...)
+}
+
+func FileUnmarshallCSVContext(ctx context.Context, filenameOrURL string, slicePtr any, options ...FileCSVOptions) error {
+	var opts FileCSVOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	ptr := reflect.ValueOf(slicePtr)
+	if ptr.Kind() != reflect.Ptr {
+		return fmt.Errorf("slicePtr must be a pointer to a slice, but is %T", slicePtr)
+	}
+	structType, isPtr, err := csvSliceElem(ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	reader, err := FileOpenDecompressedContext(ctx, filenameOrURL)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	records := csv.NewReader(reader)
+	records.Comma = opts.comma()
+	records.Comment = opts.Comment
+
+	header, err := records.Read()
+	if err == io.EOF {
+		return fmt.Errorf("CSV file '%s' has no header", filenameOrURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	// columns[i] is the field of header[i] or nil
+	fields := csvStructFields(structType, nil)
+	columns := make([]*csvField, len(header))
+	found := make(StringSet)
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		for f := range fields {
+			if fields[f].column == column {
+				columns[i] = &fields[f]
+				found.Set(column)
+				break
+			}
+		}
+		if columns[i] == nil && opts.ExtraColumns == FileCSVErrorOnColumns {
+			return fmt.Errorf("CSV column '%s' has no struct field in %s", column, structType)
+		}
+	}
+	if opts.MissingColumns == FileCSVErrorOnColumns {
+		for _, field := range fields {
+			if !found.Has(field.column) {
+				return fmt.Errorf("CSV header has no column '%s' for %s", field.column, structType)
+			}
+		}
+	}
+
+	if opts.ContinueOnError {
+		// rows with a wrong number of fields are row errors, see below
+		records.FieldsPerRecord = -1
+	}
+	slice := reflect.MakeSlice(ptr.Type().Elem(), 0, 0)
+	var rowErrors ErrorList
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(rowErrors) == 0 {
+				return err
+			}
+			return append(rowErrors, err)
+		}
+		if len(record) != len(header) {
+			line, column := records.FieldPos(0)
+			rowErrors = append(rowErrors, &csv.ParseError{StartLine: line, Line: line, Column: column, Err: csv.ErrFieldCount})
+			continue
+		}
+
+		elem := reflect.New(structType)
+		var rowErr error
+		for i, value := range record {
+			if i >= len(columns) || columns[i] == nil || value == "" {
+				continue
+			}
+			field := elem.Elem().FieldByIndex(columns[i].index)
+			if err := reflectSetFromString(field, value); err != nil {
+				line, _ := records.FieldPos(i)
+				rowErr = &FileCSVRowError{Line: line, Column: columns[i].column, Err: err}
+				break
+			}
+		}
+		if rowErr != nil {
+			if !opts.ContinueOnError {
+				return rowErr
+			}
+			rowErrors = append(rowErrors, rowErr)
+			continue
+		}
+
+		if isPtr {
+			slice = reflect.Append(slice, elem)
+		} else {
+			slice = reflect.Append(slice, elem.Elem())
+		}
+	}
+	ptr.Elem().Set(slice)
+	return rowErrors.Err()
+}
+
+// FileMarshalCSV writes slice, which must be a slice of structs or struct pointers,
+// to filename with a header record of the column names, see FileUnmarshallCSV.
+// Field values are formatted with fmt.Sprint, nil pointers as empty rows.
+func FileMarshalCSV(filename string, slice any, options ...FileCSVOptions) error {
+	var opts FileCSVOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	v := reflect.ValueOf(slice)
+	structType, isPtr, err := csvSliceElem(v.Type())
+	if err != nil {
+		return err
+	}
+	fields := csvStructFields(structType, nil)
+
+	return fileWrite(filename, []FileWriteOptions{opts.Write}, func(file io.Writer) error {
+		writer := csv.NewWriter(file)
+		writer.Comma = opts.comma()
+
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			record[i] = field.column
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if isPtr {
+				if elem.IsNil() {
+					for f := range record {
+						record[f] = ""
+					}
+					if err := writer.Write(record); err != nil {
+						return err
+					}
+					continue
+				}
+				elem = elem.Elem()
+			}
+			for f, field := range fields {
+				record[f] = fmt.Sprint(elem.FieldByIndex(field.index).Interface())
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+}
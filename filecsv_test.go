@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"encoding/csv"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCSVBase struct {
+	ID int `csv:"id"`
+}
+
+type testCSVRow struct {
+	testCSVBase
+	Name    string  `csv:"name"`
+	Price   float64 `csv:"price"`
+	Active  bool
+	Ignored string `csv:"-"`
+}
+
+func Test_FileUnmarshallCSV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rows.csv")
+	require.NoError(t, FileSetString(filename, "id;name;price;Active;extra\n1;\"a;b\";1.5;true;x\n2;c;;false;y\n"))
+
+	var rows []testCSVRow
+	require.NoError(t, FileUnmarshallCSV(filename, &rows, FileCSVOptions{Comma: ';'}))
+	require.Equal(t, []testCSVRow{
+		{testCSVBase{1}, "a;b", 1.5, true, ""},
+		{testCSVBase{2}, "c", 0, false, ""},
+	}, rows)
+
+	var ptrs []*testCSVRow
+	err := FileUnmarshallCSV(filename, &ptrs, FileCSVOptions{Comma: ';', ExtraColumns: FileCSVErrorOnColumns})
+	require.EqualError(t, err, "CSV column 'extra' has no struct field in dry.testCSVRow")
+
+	require.NoError(t, FileSetString(filename, "name,id\nok,1\nbad,x\nworse,y\nfine,4\n"))
+	err = FileUnmarshallCSV(filename, &ptrs, FileCSVOptions{MissingColumns: FileCSVErrorOnColumns})
+	require.EqualError(t, err, "CSV header has no column 'price' for dry.testCSVRow")
+
+	err = FileUnmarshallCSV(filename, &ptrs)
+	var rowErr *FileCSVRowError
+	require.True(t, errors.As(err, &rowErr))
+	require.Equal(t, 3, rowErr.Line)
+	require.Equal(t, "id", rowErr.Column)
+
+	err = FileUnmarshallCSV(filename, &ptrs, FileCSVOptions{ContinueOnError: true})
+	require.Len(t, err, 2)
+	require.Len(t, ptrs, 2)
+	require.Equal(t, 4, ptrs[1].ID)
+	require.Equal(t, "line 4, column 'id': expected integer", err.(ErrorList)[1].Error())
+
+	// short and long rows are row errors too
+	require.NoError(t, FileSetString(filename, "name,id\nok,1\nshort\nlong,2,x\nfine,4\n"))
+	err = FileUnmarshallCSV(filename, &ptrs)
+	require.True(t, errors.Is(err, csv.ErrFieldCount), "%v", err)
+	err = FileUnmarshallCSV(filename, &ptrs, FileCSVOptions{ContinueOnError: true})
+	require.Len(t, err, 2)
+	require.True(t, errors.Is(err.(ErrorList)[0], csv.ErrFieldCount))
+	require.Equal(t, "record on line 4: wrong number of fields", err.(ErrorList)[1].Error())
+	require.Len(t, ptrs, 2)
+	require.Equal(t, 4, ptrs[1].ID)
+}
+
+func Test_FileMarshalCSV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rows.csv")
+	rows := []*testCSVRow{
+		{testCSVBase{1}, "a,b", 1.5, true, "not written"},
+		nil,
+	}
+	require.NoError(t, FileMarshalCSV(filename, rows))
+	str, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "id,name,price,Active\n1,\"a,b\",1.5,true\n,,,\n", str)
+
+	var read []testCSVRow
+	require.NoError(t, FileUnmarshallCSV(filename, &read))
+	require.Equal(t, []testCSVRow{{testCSVBase{1}, "a,b", 1.5, true, ""}, {}}, read)
+
+	require.Error(t, FileMarshalCSV(filename, []string{strconv.Itoa(1)}))
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// HashAlgorithm is a hash function supported by FileHashes.
+type HashAlgorithm int
+
+const (
+	// HashSHA256 is the zero value and the default for manifests.
+	HashSHA256 HashAlgorithm = iota
+	HashMD5
+	HashSHA1
+	HashSHA3_256
+	HashSHA3_512
+	// HashCRC32 uses the IEEE polynomial.
+	HashCRC32
+	// HashCRC64 uses the ECMA polynomial like FileCRC64.
+	HashCRC64
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+func (a HashAlgorithm) String() string {
+	switch a {
+	case HashSHA256:
+		return "sha256"
+	case HashMD5:
+		return "md5"
+	case HashSHA1:
+		return "sha1"
+	case HashSHA3_256:
+		return "sha3-256"
+	case HashSHA3_512:
+		return "sha3-512"
+	case HashCRC32:
+		return "crc32"
+	case HashCRC64:
+		return "crc64"
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(a))
+}
+
+// New returns a new hash.Hash of the algorithm.
+// CRC checksums are summed as big endian bytes.
+func (a HashAlgorithm) New() hash.Hash {
+	switch a {
+	case HashSHA256:
+		return sha256.New()
+	case HashMD5:
+		return md5.New()
+	case HashSHA1:
+		return sha1.New()
+	case HashSHA3_256:
+		return sha3.New256()
+	case HashSHA3_512:
+		return sha3.New512()
+	case HashCRC32:
+		return crc32.NewIEEE()
+	case HashCRC64:
+		return crc64.New(crc64Table)
+	}
+	panic(fmt.Sprintf("unknown %s", a))
+}
+
+// HashSums maps algorithms to the sums calculated by FileHashes.
+type HashSums map[HashAlgorithm][]byte
+
+// Hex returns the hex encoded sum of algorithm, or an empty string.
+func (sums HashSums) Hex(algorithm HashAlgorithm) string {
+	return hex.EncodeToString(sums[algorithm])
+}
+
+// HashReader reads r once and returns the sums of all algorithms.
+func HashReader(r io.Reader, algorithms ...HashAlgorithm) (HashSums, error) {
+	hashes := make([]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, len(algorithms))
+	for i, algorithm := range algorithms {
+		hashes[i] = algorithm.New()
+		writers[i] = hashes[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return nil, err
+	}
+	sums := make(HashSums, len(algorithms))
+	for i, algorithm := range algorithms {
+		sums[algorithm] = hashes[i].Sum(nil)
+	}
+	return sums, nil
+}
+
+// FileHashes streams filenameOrURL once through all algorithms
+// without reading it into memory.
+// Example:
+//
+//	sums, err := FileHashes("release.tar.gz", HashSHA256, HashMD5)
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(sums.Hex(HashSHA256))
+func FileHashes(filenameOrURL string, algorithms ...HashAlgorithm) (HashSums, error) {
+	return FileHashesContext(context.Background(), filenameOrURL, algorithms...)
+}
+
+func FileHashesContext(ctx context.Context, filenameOrURL string, algorithms ...HashAlgorithm) (HashSums, error) {
+	reader, err := FileOpenContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return HashReader(reader, algorithms...)
+}
+
+// fileHashLocal hashes a local file, names like "data:,x"
+// are not treated as data URIs like by FileHashes.
+func fileHashLocal(filename string, algorithms ...HashAlgorithm) (HashSums, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return HashReader(file, algorithms...)
+}
+
+// FileManifestOptions configures FileManifest and FileVerifyManifest.
+type FileManifestOptions struct {
+	// Algorithm defaults to HashSHA256, which is compatible with sha256sum.
+	Algorithm HashAlgorithm
+	// Walk selects the files of the manifest, directories are always skipped.
+	Walk FileWalkOptions
+	// Write is used by FileWriteManifest.
+	Write FileWriteOptions
+}
+
+// FileChecksumError is returned by FileVerifyManifest
+// for a file with a different checksum.
+type FileChecksumError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *FileChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of '%s': expected %s, got %s", e.Path, e.Expected, e.Actual)
+}
+
+// FileManifest returns the checksums of all files below dir in the format
+// of sha256sum and similar tools, one "<hex>  <path>" line per file.
+// Paths are slash separated and relative to dir, so the manifest
+// can be checked with "cd dir && sha256sum -c".
+func FileManifest(dir string, options ...FileManifestOptions) ([]byte, error) {
+	var opts FileManifestOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	walkOpts := opts.Walk
+	walkOpts.SkipDirs = true
+	entries, err := FileWalk(dir, walkOpts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		if !entry.Info.Mode().IsRegular() {
+			continue
+		}
+		sums, err := fileHashLocal(entry.Path, opts.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(fileManifestLine(sums.Hex(opts.Algorithm), entry.RelPath))
+	}
+	return buf.Bytes(), nil
+}
+
+// FileWriteManifest writes the FileManifest of dir to manifestFile.
+func FileWriteManifest(dir, manifestFile string, options ...FileManifestOptions) error {
+	manifest, err := FileManifest(dir, options...)
+	if err != nil {
+		return err
+	}
+	var writeOpts []FileWriteOptions
+	if len(options) > 0 {
+		writeOpts = append(writeOpts, options[0].Write)
+	}
+	return FileSetBytes(manifestFile, manifest, writeOpts...)
+}
+
+// fileManifestLine formats a line like sha256sum, which escapes
+// backslashes and newlines in names and marks such lines with a leading backslash.
+func fileManifestLine(sum, name string) string {
+	if strings.ContainsAny(name, "\\\n\r") {
+		name = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(name)
+		return `\` + sum + "  " + name + "\n"
+	}
+	return sum + "  " + name + "\n"
+}
+
+// fileManifestParseLine parses a line written by fileManifestLine
+// or by sha256sum in binary mode ("<hex> *<path>").
+func fileManifestParseLine(line string) (sum, name string, err error) {
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+	i := strings.IndexByte(line, ' ')
+	if i <= 0 || i+2 > len(line) || (line[i+1] != ' ' && line[i+1] != '*') {
+		return "", "", fmt.Errorf("invalid checksum line '%s'", line)
+	}
+	sum, name = line[:i], line[i+2:]
+	if escaped {
+		name = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(name)
+	}
+	return sum, name, nil
+}
+
+// FileVerifyManifest checks the files below dir against the checksums
+// in manifestFilenameOrURL. Files missing from the manifest are ignored.
+// Names leaving dir, also through symlinks, are errors wrapping ErrPathEscapes.
+// All problems are returned as ErrorList, mismatches as *FileChecksumError.
+func FileVerifyManifest(dir, manifestFilenameOrURL string, options ...FileManifestOptions) error {
+	var opts FileManifestOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	reader, err := FileOpen(manifestFilenameOrURL)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var errs ErrorList
+	scanner := bufio.NewScanner(reader)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		expected, name, err := fileManifestParseLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNo, err))
+			continue
+		}
+		filename, err := PathSecureJoin(dir, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNo, err))
+			continue
+		}
+		sums, err := fileHashLocal(filename, opts.Algorithm)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if actual := sums.Hex(opts.Algorithm); !strings.EqualFold(actual, expected) {
+			errs = append(errs, &FileChecksumError{Path: name, Expected: expected, Actual: actual})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.Err()
+}
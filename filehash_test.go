@@ -0,0 +1,118 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHashes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, FileSetString(filename, "hello"))
+
+	sums, err := FileHashes(filename, HashMD5, HashSHA1, HashSHA256, HashSHA3_256, HashCRC32)
+	require.NoError(t, err)
+	require.Equal(t, "5d41402abc4b2a76b9719d911017c592", sums.Hex(HashMD5))
+	require.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", sums.Hex(HashSHA1))
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sums.Hex(HashSHA256))
+	require.Equal(t, "3338be694f50c5f338814986cdf0686453a888b84f424d792af4b9202398f392", sums.Hex(HashSHA3_256))
+	require.Equal(t, "3610a686", sums.Hex(HashCRC32))
+	require.Equal(t, "", sums.Hex(HashSHA3_512))
+
+	md5, err := FileMD5String(filename)
+	require.NoError(t, err)
+	require.Equal(t, sums.Hex(HashMD5), md5)
+
+	_, err = FileHashes(filename + ".missing")
+	require.Error(t, err)
+}
+
+func TestFileManifest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, FileSetString(filepath.Join(dir, "a.txt"), "a"))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, FileSetString(filepath.Join(dir, "sub", "b.txt"), "b"))
+	manifestFile := filepath.Join(t.TempDir(), "SHA256SUMS")
+	require.NoError(t, FileWriteManifest(dir, manifestFile))
+
+	manifest, err := FileGetString(manifestFile)
+	require.NoError(t, err)
+	require.Equal(t,
+		"ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb  a.txt\n"+
+			"3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d  sub/b.txt\n",
+		manifest)
+	require.NoError(t, FileVerifyManifest(dir, manifestFile))
+
+	if sha256sum, err := exec.LookPath("sha256sum"); err == nil {
+		cmd := exec.Command(sha256sum, "--check", "--quiet", manifestFile)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	require.NoError(t, FileSetString(filepath.Join(dir, "sub", "b.txt"), "changed"))
+	err = FileVerifyManifest(dir, manifestFile)
+	errs := AsErrorList(err)
+	require.Len(t, errs, 1)
+	checksumErr, ok := errs[0].(*FileChecksumError)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, "sub/b.txt", checksumErr.Path)
+}
+
+func TestFileManifestNames(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, FileSetString(filepath.Join(outside, "secret"), "secret"))
+	names := []string{"a.txt"}
+	if runtime.GOOS != "windows" {
+		// names that look like URLs are still local files
+		names = append(names, "data:,x", "mem:x")
+	}
+	for _, name := range names {
+		require.NoError(t, FileSetString(filepath.Join(dir, name), "content of "+name))
+	}
+	manifest, err := FileManifest(dir)
+	require.NoError(t, err)
+	for _, name := range names {
+		sums, err := HashReader(strings.NewReader("content of "+name), HashSHA256)
+		require.NoError(t, err)
+		require.Contains(t, string(manifest), sums.Hex(HashSHA256)+"  "+name+"\n")
+	}
+	manifestFile := filepath.Join(t.TempDir(), "SHA256SUMS")
+	require.NoError(t, FileSetBytes(manifestFile, manifest))
+	require.NoError(t, FileVerifyManifest(dir, manifestFile))
+
+	rel, err := filepath.Rel(dir, filepath.Join(outside, "secret"))
+	require.NoError(t, err)
+	sums, err := FileHashes(filepath.Join(outside, "secret"), HashSHA256)
+	require.NoError(t, err)
+	require.NoError(t, FileSetString(manifestFile, sums.Hex(HashSHA256)+"  "+filepath.ToSlash(rel)+"\n"))
+	errs := AsErrorList(FileVerifyManifest(dir, manifestFile))
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], ErrPathEscapes), "%v", errs[0])
+}
+
+func TestFileManifestLine(t *testing.T) {
+	for _, name := range []string{"plain.txt", `back\slash`, "new\nline"} {
+		sum, parsed, err := fileManifestParseLine(strings.TrimSuffix(fileManifestLine("00ff", name), "\n"))
+		require.NoError(t, err)
+		require.Equal(t, "00ff", sum)
+		require.Equal(t, name, parsed)
+	}
+	_, name, err := fileManifestParseLine("00ff *binary.bin")
+	require.NoError(t, err)
+	require.Equal(t, "binary.bin", name)
+	_, _, err = fileManifestParseLine("garbage")
+	require.Error(t, err)
+}
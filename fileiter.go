@@ -0,0 +1,317 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrLineTooLong is returned by the file iterators
+// if a line exceeds FileScanOptions.MaxLineLength.
+var ErrLineTooLong = errors.New("line too long")
+
+// FileScanOptions configures the streaming file iterators.
+type FileScanOptions struct {
+	// MaxLineLength is the maximum length of a line in bytes
+	// without the line terminator. Defaults to 64kb.
+	MaxLineLength int
+	// TruncateLongLines cuts lines at MaxLineLength and skips the rest of them.
+	// If not set, a longer line stops the iteration with ErrLineTooLong.
+	// CSV iterators always stop.
+	TruncateLongLines bool
+	// SkipEmptyLines makes line iterators behave like FileGetNonEmptyLines.
+	SkipEmptyLines bool
+}
+
+func fileScanOptions(options []FileScanOptions) FileScanOptions {
+	var o FileScanOptions
+	if len(options) > 0 {
+		o = options[0]
+	}
+	if o.MaxLineLength <= 0 {
+		o.MaxLineLength = bufio.MaxScanTokenSize
+	}
+	return o
+}
+
+// FileLineIterator reads the lines of a file or URL one by one,
+// so memory usage is bounded by the maximum line length.
+// Compressed files are transparently decompressed like by FileGetLines,
+// see FileOpenDecompressed.
+// \n is used to detect line ends, a preceding \r will be stripped away.
+//
+// Usage example:
+//
+//	lines, err := FileIterateLines("huge.log")
+//	if err != nil {
+//		return err
+//	}
+//	defer lines.Close()
+//	for lines.Next() {
+//		fmt.Println(lines.LineNumber(), lines.Line())
+//	}
+//	return lines.Err()
+type FileLineIterator struct {
+	reader  io.ReadCloser
+	buf     *bufio.Reader
+	options FileScanOptions
+	line    []byte
+	number  int
+	err     error
+}
+
+// FileIterateLines opens filenameOrURL for line by line reading
+// according to the first optional options.
+func FileIterateLines(filenameOrURL string, options ...FileScanOptions) (*FileLineIterator, error) {
+	return FileIterateLinesContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileIterateLinesContext(ctx context.Context, filenameOrURL string, options ...FileScanOptions) (*FileLineIterator, error) {
+	reader, err := FileOpenDecompressedContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewLineIterator(reader, options...), nil
+}
+
+// NewLineIterator returns a FileLineIterator reading from reader.
+// Close closes reader, if it implements io.Closer.
+func NewLineIterator(reader io.Reader, options ...FileScanOptions) *FileLineIterator {
+	closer, ok := reader.(io.ReadCloser)
+	if !ok {
+		closer = ioutil.NopCloser(reader)
+	}
+	return &FileLineIterator{
+		reader:  closer,
+		buf:     bufio.NewReader(reader),
+		options: fileScanOptions(options),
+	}
+}
+
+// Next reads the next line and returns true,
+// or returns false at the end of the input or on error.
+func (it *FileLineIterator) Next() bool {
+	for it.err == nil {
+		line, err := it.readLine()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.number++
+		if it.options.SkipEmptyLines && len(line) == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (it *FileLineIterator) readLine() ([]byte, error) {
+	max := it.options.MaxLineLength
+	it.line = it.line[:0]
+	overflow := false
+	empty := true
+	for {
+		chunk, err := it.buf.ReadSlice('\n')
+		if len(chunk) > 0 {
+			empty = false
+		}
+		if !overflow {
+			it.line = append(it.line, chunk...)
+		}
+
+		switch err {
+		case bufio.ErrBufferFull:
+			// a trailing \r could still be part of the terminator
+			if !overflow && len(it.line) > max+1 {
+				if !it.options.TruncateLongLines {
+					return nil, fmt.Errorf("line %d: %w", it.number+1, ErrLineTooLong)
+				}
+				it.line = it.line[:max]
+				overflow = true
+			}
+			continue
+		case nil, io.EOF:
+			if err == io.EOF && empty {
+				return nil, io.EOF
+			}
+			if !overflow {
+				it.line = bytes.TrimSuffix(it.line, []byte{'\n'})
+				it.line = bytes.TrimSuffix(it.line, []byte{'\r'})
+				if len(it.line) > max {
+					if !it.options.TruncateLongLines {
+						return nil, fmt.Errorf("line %d: %w", it.number+1, ErrLineTooLong)
+					}
+					it.line = it.line[:max]
+				}
+			}
+			return it.line, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// Line returns the current line as string.
+func (it *FileLineIterator) Line() string {
+	return string(it.line)
+}
+
+// Bytes returns the current line. The slice is only valid until the next call of Next.
+func (it *FileLineIterator) Bytes() []byte {
+	return it.line
+}
+
+// LineNumber returns the 1 based number of the current line.
+// Skipped empty lines are counted too.
+func (it *FileLineIterator) LineNumber() int {
+	return it.number
+}
+
+// Err returns the error that stopped the iteration, nil at the end of the input.
+func (it *FileLineIterator) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
+
+func (it *FileLineIterator) Close() error {
+	if it.err == nil {
+		it.err = io.EOF
+	}
+	return it.reader.Close()
+}
+
+// FileJSONLinesIterator reads JSON Lines (http://jsonlines.org) one value at a time.
+// Empty lines are skipped.
+type FileJSONLinesIterator struct {
+	*FileLineIterator
+}
+
+// FileIterateJSONLines opens filenameOrURL for reading JSON Lines
+// according to the first optional options. SkipEmptyLines is implied.
+func FileIterateJSONLines(filenameOrURL string, options ...FileScanOptions) (*FileJSONLinesIterator, error) {
+	return FileIterateJSONLinesContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileIterateJSONLinesContext(ctx context.Context, filenameOrURL string, options ...FileScanOptions) (*FileJSONLinesIterator, error) {
+	o := fileScanOptions(options)
+	o.SkipEmptyLines = true
+	lines, err := FileIterateLinesContext(ctx, filenameOrURL, o)
+	if err != nil {
+		return nil, err
+	}
+	return &FileJSONLinesIterator{lines}, nil
+}
+
+// Decode unmarshals the current line into result.
+func (it *FileJSONLinesIterator) Decode(result any) error {
+	if err := json.Unmarshal(it.Bytes(), result); err != nil {
+		return fmt.Errorf("line %d: %w", it.LineNumber(), err)
+	}
+	return nil
+}
+
+// FileCSVIterator reads the records of a CSV file one by one,
+// compressed files are transparently decompressed like by FileGetCSV.
+// A physical line longer than FileScanOptions.MaxLineLength
+// stops the iteration with ErrLineTooLong.
+type FileCSVIterator struct {
+	reader io.ReadCloser
+	csv    *csv.Reader
+	record []string
+	err    error
+}
+
+// FileIterateCSV opens filenameOrURL for reading CSV records
+// according to the first optional options.
+func FileIterateCSV(filenameOrURL string, options ...FileScanOptions) (*FileCSVIterator, error) {
+	return FileIterateCSVContext(context.Background(), filenameOrURL, options...)
+}
+
+func FileIterateCSVContext(ctx context.Context, filenameOrURL string, options ...FileScanOptions) (*FileCSVIterator, error) {
+	reader, err := FileOpenDecompressedContext(ctx, filenameOrURL)
+	if err != nil {
+		return nil, err
+	}
+	o := fileScanOptions(options)
+	limited := &lineLimitReader{reader: reader, max: o.MaxLineLength}
+	return &FileCSVIterator{
+		reader: reader,
+		csv:    csv.NewReader(limited),
+	}, nil
+}
+
+// CSVReader returns the underlying csv.Reader,
+// so Comma, Comment etc. can be configured before the first call of Next.
+func (it *FileCSVIterator) CSVReader() *csv.Reader {
+	return it.csv
+}
+
+// Next reads the next record and returns true,
+// or returns false at the end of the input or on error.
+func (it *FileCSVIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.record, it.err = it.csv.Read()
+	return it.err == nil
+}
+
+// Record returns the current record.
+func (it *FileCSVIterator) Record() []string {
+	return it.record
+}
+
+// Err returns the error that stopped the iteration, nil at the end of the input.
+func (it *FileCSVIterator) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
+
+func (it *FileCSVIterator) Close() error {
+	if it.err == nil {
+		it.err = io.EOF
+	}
+	return it.reader.Close()
+}
+
+// lineLimitReader fails with ErrLineTooLong if more than max bytes
+// are read without a newline.
+type lineLimitReader struct {
+	reader io.Reader
+	max    int
+	line   int
+	count  int
+}
+
+func (r *lineLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for _, c := range p[:n] {
+		if c == '\n' {
+			r.line++
+			r.count = 0
+			continue
+		}
+		r.count++
+		// a \r directly before \n belongs to the terminator
+		if r.count > r.max+1 || r.count == r.max+1 && c != '\r' {
+			return 0, fmt.Errorf("line %d: %w", r.line+1, ErrLineTooLong)
+		}
+	}
+	return n, err
+}
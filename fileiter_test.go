@@ -0,0 +1,85 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileIterateLines(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	FileMem.WriteFile("mem://lines.txt", []byte("a\r\n\nb\n"+long+"\nc"))
+	defer FileMem.Remove("lines.txt")
+
+	lines, err := FileIterateLines("mem://lines.txt", FileScanOptions{SkipEmptyLines: true})
+	require.NoError(t, err)
+	var result []string
+	var numbers []int
+	for lines.Next() {
+		result = append(result, lines.Line())
+		numbers = append(numbers, lines.LineNumber())
+	}
+	require.NoError(t, lines.Err())
+	require.NoError(t, lines.Close())
+	require.Equal(t, []string{"a", "b", long, "c"}, result)
+	require.Equal(t, []int{1, 3, 4, 5}, numbers)
+
+	lines, err = FileIterateLines("mem://lines.txt", FileScanOptions{MaxLineLength: 100})
+	require.NoError(t, err)
+	for lines.Next() {
+	}
+	require.True(t, errors.Is(lines.Err(), ErrLineTooLong))
+	require.Contains(t, lines.Err().Error(), "line 4")
+	lines.Close()
+
+	lines, err = FileIterateLines("mem://lines.txt", FileScanOptions{MaxLineLength: 100, TruncateLongLines: true})
+	require.NoError(t, err)
+	result = nil
+	for lines.Next() {
+		result = append(result, lines.Line())
+	}
+	require.NoError(t, lines.Err())
+	lines.Close()
+	require.Equal(t, []string{"a", "", "b", long[:100], "c"}, result)
+}
+
+func Test_FileIterateJSONLines(t *testing.T) {
+	values, err := FileIterateJSONLines(`data:,{"n":1}%0A%0A{"n":2}%0A`)
+	require.NoError(t, err)
+	defer values.Close()
+	var result []int
+	for values.Next() {
+		var v struct{ N int }
+		require.NoError(t, values.Decode(&v))
+		result = append(result, v.N)
+	}
+	require.NoError(t, values.Err())
+	require.Equal(t, []int{1, 2}, result)
+}
+
+func Test_FileIterateCSV(t *testing.T) {
+	records, err := FileIterateCSV("data:,a;b%0A%22c%0Ad%22;e%0A")
+	require.NoError(t, err)
+	records.CSVReader().Comma = ';'
+	var result [][]string
+	for records.Next() {
+		result = append(result, records.Record())
+	}
+	require.NoError(t, records.Err())
+	records.Close()
+	require.Equal(t, [][]string{{"a", "b"}, {"c\nd", "e"}}, result)
+
+	records, err = FileIterateCSV("data:,a,b%0A"+strings.Repeat("x", 50), FileScanOptions{MaxLineLength: 10})
+	require.NoError(t, err)
+	for records.Next() {
+	}
+	require.True(t, errors.Is(records.Err(), ErrLineTooLong))
+	records.Close()
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileLockMode is the mode of a FileLock.
+type FileLockMode int
+
+const (
+	// FileLockExclusive allows only one holder, for writers.
+	FileLockExclusive FileLockMode = iota
+	// FileLockShared allows many holders at the same time, for readers.
+	// Lockfiles don't support shared locks, they are always exclusive.
+	FileLockShared
+)
+
+// ErrFileLockHeld is returned by FileLock.TryLock
+// if the FileLock is already held in this process.
+var ErrFileLockHeld = errors.New("file lock already held")
+
+// errFileFlockUnsupported is returned by fileFlock if the file system
+// or platform doesn't support flock.
+var errFileFlockUnsupported = errors.New("flock not supported")
+
+// FileLockOptions configures a FileLock.
+type FileLockOptions struct {
+	// UseLockfile uses a lockfile created with O_EXCL instead of flock,
+	// for example for network file systems where flock doesn't work
+	// across machines. Lockfiles are also used where flock is not available.
+	UseLockfile bool
+	// StaleAfter is the age after which a lockfile is considered stale
+	// and gets removed. Lockfiles of dead processes on the same host are
+	// always stale. Zero disables the age check.
+	StaleAfter time.Duration
+	// PollInterval is the wait time between attempts while waiting
+	// for the lock. Defaults to 50ms.
+	PollInterval time.Duration
+}
+
+/*
+FileLock is an advisory lock coordinating processes
+that access the same file.
+It is held on a separate lock file, so replacing the protected file
+(like FileSet* with FileAtomic does) doesn't release it.
+
+On Unix flock is used, so locks are released by the kernel
+if a process dies. Elsewhere, and with FileLockOptions.UseLockfile,
+the lock is the existence of a lockfile containing the PID and host
+of its holder, with stale lockfiles being removed.
+Example:
+
+	lock := NewFileLock("data.json")
+	if err := lock.LockContext(ctx, FileLockExclusive); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	err = FileSetJSON("data.json", data)
+
+A FileLock can be used by multiple goroutines, but only one holds it at a time,
+even in FileLockShared mode. Lock and LockContext wait for the holding goroutine
+to unlock, while TryLock returns ErrFileLockHeld. Like sync.Mutex,
+a FileLock is not reentrant, so locking it again without unlocking waits forever.
+*/
+type FileLock struct {
+	path    string
+	options FileLockOptions
+
+	mutex    sync.Mutex
+	file     *os.File      // open lock file while flock is held
+	lockfile bool          // lockfile is held
+	released chan struct{} // closed by Unlock
+}
+
+// NewFileLock returns an unlocked FileLock for filename
+// using the lock file filename+".lock".
+func NewFileLock(filename string, options ...FileLockOptions) *FileLock {
+	lock := &FileLock{path: filename + ".lock"}
+	if len(options) > 0 {
+		lock.options = options[0]
+	}
+	return lock
+}
+
+// Path returns the path of the lock file.
+func (lock *FileLock) Path() string {
+	return lock.path
+}
+
+// Lock waits until the lock could be acquired in mode.
+func (lock *FileLock) Lock(mode FileLockMode) error {
+	return lock.LockContext(context.Background(), mode)
+}
+
+// LockContext waits until the lock could be acquired in mode,
+// or returns the error of ctx when it is done.
+func (lock *FileLock) LockContext(ctx context.Context, mode FileLockMode) error {
+	interval := lock.options.PollInterval
+	if interval <= 0 {
+		interval = 50 * time.Millisecond
+	}
+	for {
+		acquired, err := lock.TryLock(mode)
+		if acquired || err != nil && err != ErrFileLockHeld {
+			return err
+		}
+		if err == ErrFileLockHeld {
+			// held by another goroutine, wait for its Unlock
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-lock.releasedChan():
+			}
+			continue
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// releasedChan returns a channel closed by the next Unlock,
+// or a closed channel if the lock is not held.
+func (lock *FileLock) releasedChan() <-chan struct{} {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.released == nil {
+		released := make(chan struct{})
+		close(released)
+		return released
+	}
+	return lock.released
+}
+
+// TryLock acquires the lock in mode if that is possible without waiting.
+// It returns ErrFileLockHeld if the FileLock is already held.
+func (lock *FileLock) TryLock(mode FileLockMode) (acquired bool, err error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.file != nil || lock.lockfile {
+		return false, ErrFileLockHeld
+	}
+
+	if !lock.options.UseLockfile {
+		file, created, err := lock.openFlockFile()
+		if err != nil {
+			return false, err
+		}
+		acquired, err = fileFlock(file, mode)
+		if err != errFileFlockUnsupported {
+			if !acquired || err != nil {
+				file.Close()
+				return false, err
+			}
+			lock.file = file
+			lock.released = make(chan struct{})
+			return true, nil
+		}
+		file.Close()
+		// the empty file created for flock is no lockfile, but an existing
+		// file can be the lockfile of another process that was just created
+		if created {
+			os.Remove(lock.path)
+		}
+	}
+
+	acquired, err = lock.tryLockfile()
+	lock.lockfile = acquired
+	if acquired {
+		lock.released = make(chan struct{})
+	}
+	return acquired, err
+}
+
+// openFlockFile opens or creates the lock file for flock
+// and reports if it was created by this call.
+func (lock *FileLock) openFlockFile() (file *os.File, created bool, err error) {
+	for {
+		file, err = os.OpenFile(lock.path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0660)
+		if err == nil {
+			return file, true, nil
+		}
+		if !os.IsExist(err) {
+			return nil, false, err
+		}
+		file, err = os.OpenFile(lock.path, os.O_RDWR, 0)
+		if !os.IsNotExist(err) {
+			return file, false, err
+		}
+		// removed in the meantime, create it again
+	}
+}
+
+func (lock *FileLock) tryLockfile() (bool, error) {
+	host, _ := os.Hostname()
+	content := fmt.Sprintf("%d\n%s\n", os.Getpid(), host)
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lock.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+		if err == nil {
+			_, err = file.WriteString(content)
+			if err = FirstError(err, file.Close()); err != nil {
+				os.Remove(lock.path)
+				return false, err
+			}
+			return true, nil
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+		removed, err := lock.removeStale()
+		if !removed || err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// fileLockTakeoverStaleAfter is the age after which the takeover file
+// of a process that crashed while removing a stale lockfile is removed.
+const fileLockTakeoverStaleAfter = 10 * time.Second
+
+/*
+removeStale removes the lockfile if it is stale.
+
+Processes that found the same lockfile stale would otherwise race:
+one removes it and creates its own, then the other removes that fresh
+lockfile and creates another, and both hold the lock.
+So removals are serialized by a takeover file created with O_EXCL,
+and the lockfile is checked again while holding it.
+*/
+func (lock *FileLock) removeStale() (removed bool, err error) {
+	info, stale := lock.stale()
+	if !stale {
+		return false, nil
+	}
+	return lock.takeOver(info)
+}
+
+// takeOver removes the lockfile found stale with info
+// while holding the takeover file, see removeStale.
+func (lock *FileLock) takeOver(info os.FileInfo) (removed bool, err error) {
+	takeover := lock.path + ".takeover"
+	file, err := os.OpenFile(takeover, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if os.IsExist(err) {
+		// another process is taking over, or crashed while doing so
+		if takeoverInfo, err := os.Stat(takeover); err == nil && time.Since(takeoverInfo.ModTime()) > fileLockTakeoverStaleAfter {
+			os.Remove(takeover)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	file.Close()
+	defer os.Remove(takeover)
+
+	// the lockfile could have been taken over since it was found stale,
+	// its inode can be reused, so the content is checked again too
+	current, stale := lock.stale()
+	if !stale || !os.SameFile(info, current) {
+		return false, nil
+	}
+	if err = os.Remove(lock.path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// stale reports if the existing lockfile belongs to a dead process
+// or is older than options.StaleAfter, and returns its info.
+func (lock *FileLock) stale() (os.FileInfo, bool) {
+	info, err := os.Stat(lock.path)
+	if err != nil {
+		return nil, false
+	}
+	if lock.options.StaleAfter > 0 && time.Since(info.ModTime()) > lock.options.StaleAfter {
+		return info, true
+	}
+	data, err := ioutil.ReadFile(lock.path)
+	if err != nil {
+		return nil, false
+	}
+	pidStr, lockHost := StringSplitOnceChar(strings.TrimSpace(string(data)), '\n')
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		// a lockfile being written right now has no content yet,
+		// one without content for longer was left by a crash
+		return info, time.Since(info.ModTime()) > 10*time.Second
+	}
+	host, _ := os.Hostname()
+	return info, lockHost == host && !fileProcessAlive(pid)
+}
+
+// Unlock releases the lock.
+func (lock *FileLock) Unlock() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.released != nil {
+		close(lock.released)
+		lock.released = nil
+	}
+	switch {
+	case lock.file != nil:
+		// the lock file is not removed, another process could
+		// already have opened it to wait for the lock
+		err := FirstError(fileFunlock(lock.file), lock.file.Close())
+		lock.file = nil
+		return err
+	case lock.lockfile:
+		lock.lockfile = false
+		return os.Remove(lock.path)
+	}
+	return fmt.Errorf("file lock '%s' is not held", lock.path)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileLock(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.json")
+	for _, useLockfile := range []bool{false, true} {
+		filename := filepath.Join(dir, "data-"+strconv.FormatBool(useLockfile))
+		options := FileLockOptions{UseLockfile: useLockfile, PollInterval: time.Millisecond}
+		a := NewFileLock(filename, options)
+		b := NewFileLock(filename, options)
+
+		require.NoError(t, a.Lock(FileLockExclusive))
+		_, err := a.TryLock(FileLockExclusive)
+		require.Equal(t, ErrFileLockHeld, err)
+		acquired, err := b.TryLock(FileLockShared)
+		require.NoError(t, err)
+		require.False(t, acquired)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		require.Equal(t, context.DeadlineExceeded, b.LockContext(ctx, FileLockExclusive))
+		cancel()
+
+		done := make(chan error)
+		go func() { done <- b.Lock(FileLockExclusive) }()
+		time.Sleep(5 * time.Millisecond)
+		require.NoError(t, a.Unlock())
+		require.NoError(t, <-done)
+		require.NoError(t, b.Unlock())
+		require.Error(t, b.Unlock())
+	}
+
+	a := NewFileLock(filename)
+	b := NewFileLock(filename)
+	require.NoError(t, a.Lock(FileLockShared))
+	acquired, err := b.TryLock(FileLockShared)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	acquired, err = NewFileLock(filename).TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.NoError(t, a.Unlock())
+	require.NoError(t, b.Unlock())
+}
+
+func Test_FileLockStale(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	lock := NewFileLock(filename, FileLockOptions{UseLockfile: true})
+	host, _ := os.Hostname()
+
+	// a process that surely doesn't exist
+	require.NoError(t, FileSetString(lock.Path(), strconv.Itoa(1<<22+12345)+"\n"+host+"\n"))
+	acquired, err := lock.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, lock.Unlock())
+	require.False(t, FileExists(lock.Path()))
+
+	// alive process on another host
+	require.NoError(t, FileSetString(lock.Path(), strconv.Itoa(os.Getpid())+"\nother-host\n"))
+	acquired, err = lock.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(lock.Path(), old, old))
+	lock = NewFileLock(filename, FileLockOptions{UseLockfile: true, StaleAfter: time.Minute})
+	acquired, err = lock.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, lock.Unlock())
+}
+
+func Test_FileLockStaleTakeover(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	host, _ := os.Hostname()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, FileSetString(filename+".lock", strconv.Itoa(1<<22+12345)+"\n"+host+"\n"))
+
+		// competing takeovers of the same stale lockfile, like by several processes
+		start := make(chan struct{})
+		winners := make(chan *FileLock, 8)
+		var wg sync.WaitGroup
+		for j := 0; j < cap(winners); j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lock := NewFileLock(filename, FileLockOptions{UseLockfile: true})
+				<-start
+				if acquired, err := lock.TryLock(FileLockExclusive); err == nil && acquired {
+					winners <- lock
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(winners)
+
+		require.Len(t, winners, 1, "exactly one takeover succeeds")
+		require.NoError(t, (<-winners).Unlock())
+		require.False(t, FileExists(filename+".lock.takeover"))
+	}
+
+	// a found the lockfile stale, but b took it over first
+	require.NoError(t, FileSetString(filename+".lock", strconv.Itoa(1<<22+12345)+"\n"+host+"\n"))
+	a := NewFileLock(filename, FileLockOptions{UseLockfile: true})
+	b := NewFileLock(filename, FileLockOptions{UseLockfile: true})
+	info, stale := a.stale()
+	require.True(t, stale)
+	acquired, err := b.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	removed, err := a.takeOver(info)
+	require.NoError(t, err)
+	require.False(t, removed, "fresh lockfile of b removed")
+	acquired, err = a.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.NoError(t, b.Unlock())
+
+	// a takeover file left by a crash doesn't block forever
+	require.NoError(t, FileSetString(filename+".lock", strconv.Itoa(1<<22+12345)+"\n"+host+"\n"))
+	require.NoError(t, FileSetString(filename+".lock.takeover", ""))
+	acquired, err = a.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	old := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(filename+".lock.takeover", old, old))
+	acquired, err = a.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	acquired, err = a.TryLock(FileLockExclusive)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, a.Unlock())
+}
+
+func Test_FileLockGoroutines(t *testing.T) {
+	dir := t.TempDir()
+	for _, useLockfile := range []bool{false, true} {
+		filename := filepath.Join(dir, "data-"+strconv.FormatBool(useLockfile))
+		lock := NewFileLock(filename, FileLockOptions{UseLockfile: useLockfile, PollInterval: time.Millisecond})
+		require.NoError(t, lock.Lock(FileLockExclusive))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		require.Equal(t, context.DeadlineExceeded, lock.LockContext(ctx, FileLockExclusive))
+		cancel()
+
+		done := make(chan error)
+		go func() { done <- lock.Lock(FileLockExclusive) }()
+		time.Sleep(5 * time.Millisecond)
+		select {
+		case err := <-done:
+			t.Fatalf("second goroutine didn't wait: %v", err)
+		default:
+		}
+		require.NoError(t, lock.Unlock())
+		require.NoError(t, <-done)
+		require.NoError(t, lock.Unlock())
+	}
+}
+
+func Test_FileLockOpenFlockFile(t *testing.T) {
+	lock := NewFileLock(filepath.Join(t.TempDir(), "data.json"))
+	file, created, err := lock.openFlockFile()
+	require.NoError(t, err)
+	require.True(t, created)
+	file.Close()
+
+	// an existing file may be the lockfile of another process
+	file, created, err = lock.openFlockFile()
+	require.NoError(t, err)
+	require.False(t, created)
+	file.Close()
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build !windows
+
+package dry
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileFlock tries to flock file without blocking.
+func fileFlock(file *os.File, mode FileLockMode) (acquired bool, err error) {
+	how := unix.LOCK_EX
+	if mode == FileLockShared {
+		how = unix.LOCK_SH
+	}
+	for {
+		err = unix.Flock(int(file.Fd()), how|unix.LOCK_NB)
+		switch {
+		case err == nil:
+			return true, nil
+		case err == unix.EINTR:
+			continue
+		case err == unix.EWOULDBLOCK:
+			return false, nil
+		// ENOTSUP and EOPNOTSUPP are the same on some systems
+		case err == unix.ENOTSUP || err == unix.EOPNOTSUPP || err == unix.ENOLCK:
+			return false, errFileFlockUnsupported
+		}
+		return false, &os.PathError{Op: "flock", Path: file.Name(), Err: err}
+	}
+}
+
+func fileFunlock(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_UN)
+}
+
+// fileProcessAlive reports if a process with pid exists.
+func fileProcessAlive(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build windows
+
+package dry
+
+import (
+	"os"
+)
+
+// fileFlock is not available, FileLock uses lockfiles on windows.
+func fileFlock(file *os.File, mode FileLockMode) (acquired bool, err error) {
+	return false, errFileFlockUnsupported
+}
+
+func fileFunlock(file *os.File) error {
+	return nil
+}
+
+// fileProcessAlive reports if a process with pid exists.
+func fileProcessAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RotatingFileOptions configures a RotatingFile.
+type RotatingFileOptions struct {
+	// MaxSize rotates the file before a write would make it larger.
+	// Zero means no size limit.
+	MaxSize int64
+	// Interval rotates the file with the first write after it was
+	// opened for this duration. Zero disables time based rotation.
+	Interval time.Duration
+	// Backups is the number of rotated files to keep, zero keeps all.
+	Backups int
+	// Compress gzips rotated files in the background.
+	Compress bool
+	// ReopenOnSIGHUP reopens the file when the process receives SIGHUP,
+	// for external tools that move the file away.
+	ReopenOnSIGHUP bool
+	// Perm defaults to 0660.
+	Perm os.FileMode
+}
+
+/*
+RotatingFile is an io.WriteCloser appending to a file that gets rotated
+by size or age. Rotated files are named like logrotate does:
+the current file is renamed to filename.1 (filename.1.gz if compressed),
+older backups are shifted to filename.2 and so on.
+Example:
+
+	logFile, err := NewRotatingFile("service.log", RotatingFileOptions{
+		MaxSize:  100 << 20,
+		Backups:  5,
+		Compress: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	log.SetOutput(logFile)
+
+RotatingFile is safe for concurrent use.
+*/
+type RotatingFile struct {
+	filename string
+	options  RotatingFileOptions
+
+	mutex  sync.Mutex
+	file   *os.File // nil after a failed rotation, opened again by the next call
+	closed bool
+	size   int64
+	opened time.Time
+
+	// only one rotated file is compressed at a time,
+	// compressErr is read after waiting for it
+	compressing sync.WaitGroup
+	compressErr error
+
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// NewRotatingFile opens or creates filename for appending.
+func NewRotatingFile(filename string, options ...RotatingFileOptions) (*RotatingFile, error) {
+	r := &RotatingFile{filename: filename}
+	if len(options) > 0 {
+		r.options = options[0]
+	}
+	if r.options.Perm == 0 {
+		r.options.Perm = 0660
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if r.options.ReopenOnSIGHUP {
+		r.signals = make(chan os.Signal, 1)
+		r.done = make(chan struct{})
+		signal.Notify(r.signals, syscall.SIGHUP)
+		go func() {
+			for {
+				select {
+				case <-r.signals:
+					r.Reopen()
+				case <-r.done:
+					return
+				}
+			}
+		}()
+	}
+	return r, nil
+}
+
+// Name returns the name of the current file.
+func (r *RotatingFile) Name() string {
+	return r.filename
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, r.options.Perm)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the file, rotating it before if necessary.
+func (r *RotatingFile) Write(p []byte) (n int, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err = r.check(); err != nil {
+		return 0, err
+	}
+	if r.size > 0 && (r.options.MaxSize > 0 && r.size+int64(len(p)) > r.options.MaxSize ||
+		r.options.Interval > 0 && time.Since(r.opened) >= r.options.Interval) {
+		if err = r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now.
+func (r *RotatingFile) Rotate() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.check(); err != nil {
+		return err
+	}
+	return r.rotate()
+}
+
+// Reopen closes the file and opens filename again, without rotating it.
+func (r *RotatingFile) Reopen() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file != nil {
+		err := r.file.Close()
+		r.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// Sync commits the current file to stable storage.
+func (r *RotatingFile) Sync() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.check(); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// check returns os.ErrClosed after Close, and opens
+// the file again if a previous rotation failed to do so.
+// It must be called with r.mutex locked.
+func (r *RotatingFile) check() error {
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file == nil {
+		return r.open()
+	}
+	return nil
+}
+
+// Close closes the file and waits until all rotated files are compressed.
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return os.ErrClosed
+	}
+	r.closed = true
+	if r.done != nil {
+		signal.Stop(r.signals)
+		close(r.done)
+	}
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mutex.Unlock()
+
+	r.compressing.Wait()
+	return FirstError(err, r.compressErr)
+}
+
+func (r *RotatingFile) backupName(i int) string {
+	name := r.filename + "." + strconv.Itoa(i)
+	if r.options.Compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// rotate must be called with r.mutex locked.
+// The current file stays open until the new one is opened,
+// so a failed rotation doesn't stop further writes.
+func (r *RotatingFile) rotate() error {
+	// backups are renamed below, so the last compression must be finished
+	r.compressing.Wait()
+	if err := r.compressErr; err != nil {
+		r.compressErr = nil
+		return err
+	}
+
+	last := r.options.Backups
+	if last <= 0 {
+		for last = 1; FileExists(r.backupName(last)); last++ {
+		}
+	}
+	if err := os.Remove(r.backupName(last)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := last - 1; i >= 1; i-- {
+		if err := os.Rename(r.backupName(i), r.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	old := r.file
+	rotated := r.filename + ".1"
+	if err := os.Rename(r.filename, rotated); err != nil {
+		// Windows can't rename open files
+		r.file = nil
+		if closeErr := old.Close(); closeErr != nil {
+			return FirstError(err, closeErr)
+		}
+		old = nil
+		if err = os.Rename(r.filename, rotated); err != nil {
+			// continue with the original file
+			return FirstError(err, r.open())
+		}
+	}
+	if err := r.open(); err != nil {
+		if old != nil {
+			// move the still open file back instead of losing writes
+			if os.Rename(rotated, r.filename) == nil {
+				r.file = old
+			} else {
+				r.file = nil
+				old.Close()
+			}
+		}
+		return err
+	}
+	var err error
+	if old != nil {
+		err = old.Close()
+	}
+
+	if r.options.Compress {
+		r.compressing.Add(1)
+		go func() {
+			defer r.compressing.Done()
+			r.compressErr = fileGzipAndRemove(rotated, rotated+".gz")
+		}()
+	}
+	return err
+}
+
+// fileGzipAndRemove atomically writes source gzip compressed to dest
+// and removes source.
+func fileGzipAndRemove(source, dest string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = fileWrite(dest, []FileWriteOptions{FileAtomic}, func(writer io.Writer) error {
+		buffered := bufio.NewWriter(writer)
+		gzipWriter := Gzip.GetWriter(buffered)
+		_, err := io.Copy(gzipWriter, file)
+		if err == nil {
+			err = gzipWriter.Close()
+		}
+		Gzip.ReturnWriter(gzipWriter)
+		if err != nil {
+			return err
+		}
+		return buffered.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
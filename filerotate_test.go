@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	r, err := NewRotatingFile(filename, RotatingFileOptions{MaxSize: 10, Backups: 2})
+	require.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n", "fifth\n"} {
+		_, err = r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	check := func(name, expected string) {
+		data, err := FileGetString(name)
+		require.NoError(t, err)
+		require.Equal(t, expected, data)
+	}
+	check(filename, "fifth\n")
+	check(filename+".1", "fourth\n")
+	check(filename+".2", "third\n")
+	require.False(t, FileExists(filename+".3"))
+
+	_, err = r.Write([]byte("closed"))
+	require.Error(t, err)
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, FileSetString(filename, "existing\n"))
+	r, err := NewRotatingFile(filename, RotatingFileOptions{Compress: true})
+	require.NoError(t, err)
+	for _, line := range []string{"a\n", "b\n"} {
+		require.NoError(t, r.Rotate())
+		_, err = r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	data, err := FileGetString(filename + ".2.gz")
+	require.NoError(t, err)
+	require.Equal(t, "existing\n", data)
+	data, err = FileGetString(filename + ".1.gz")
+	require.NoError(t, err)
+	require.Equal(t, "a\n", data)
+	require.False(t, FileExists(filename+".1"))
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	r, err := NewRotatingFile(filename, RotatingFileOptions{Interval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = r.Write([]byte("old\n"))
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = r.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.True(t, FileExists(filename+".1"))
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	r, err := NewRotatingFile(filename, RotatingFileOptions{ReopenOnSIGHUP: true})
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = r.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// like logrotate moving the file away
+	require.NoError(t, os.Rename(filename, filepath.Join(dir, "moved.log")))
+	require.NoError(t, r.Reopen())
+	_, err = r.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	data, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "after\n", data)
+}
+
+func TestRotatingFileRotateError(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	r, err := NewRotatingFile(filename, RotatingFileOptions{Backups: 1, Compress: true, ReopenOnSIGHUP: true})
+	require.NoError(t, err)
+	_, err = r.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	// a directory in the way makes renaming the file fail
+	require.NoError(t, os.MkdirAll(filepath.Join(filename+".1", "sub"), 0755))
+	require.Error(t, r.Rotate())
+	_, err = r.Write([]byte("second\n"))
+	require.NoError(t, err, "still writable after a failed rotation")
+	data, err := FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", data)
+
+	require.NoError(t, os.RemoveAll(filename+".1"))
+	require.NoError(t, r.Rotate())
+	_, err = r.Write([]byte("third\n"))
+	require.NoError(t, err)
+
+	// a file that couldn't be opened again is retried by the next call
+	r.mutex.Lock()
+	r.file.Close()
+	r.file = nil
+	r.mutex.Unlock()
+	_, err = r.Write([]byte("fourth\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, r.Close())
+	select {
+	case <-r.done:
+	default:
+		t.Fatal("signal handler not stopped")
+	}
+	require.Equal(t, os.ErrClosed, r.Close())
+
+	data, err = FileGetString(filename)
+	require.NoError(t, err)
+	require.Equal(t, "third\nfourth\n", data)
+	data, err = FileGetString(filename + ".1.gz")
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", data)
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOpenerFunc opens the resource addressed by url for reading.
+// url is passed as is, including the scheme prefix.
+// timeout is zero if the caller didn't limit the operation.
+type FileOpenerFunc func(url string, timeout time.Duration) (io.ReadCloser, error)
+
+// FileContextOpenerFunc is like FileOpenerFunc, but cancellation
+// of ctx must abort opening and reading the resource.
+type FileContextOpenerFunc func(ctx context.Context, url string) (io.ReadCloser, error)
+
+var fileSchemes = struct {
+	sync.RWMutex
+	openers map[string]FileContextOpenerFunc
+}{
+	openers: map[string]FileContextOpenerFunc{
+		"file":  fileOpenLocalURL,
+		"http":  fileOpenHTTP,
+		"https": fileOpenHTTP,
+		"data":  fileOpenData,
+		"mem":   fileContextOpener(FileMem.Open),
+	},
+}
+
+// FileRegisterScheme registers opener for all filenameOrURL arguments
+// starting with "scheme://", so FileGetBytes and all helpers built on top of it
+// (JSON, XML, CSV, lines, config, MD5, CRC64) can read from it.
+// Schemes are case insensitive, an already registered opener gets replaced.
+// Names like "scheme:name" without "//" are local filenames,
+// only RFC 2397 data URIs are recognized without it.
+// The remaining time until the deadline of the context passed
+// to the *Context helpers is the timeout of opener.
+func FileRegisterScheme(scheme string, opener FileOpenerFunc) {
+	if opener == nil {
+		panic("scheme and opener must be set")
+	}
+	FileRegisterSchemeContext(scheme, fileContextOpener(opener))
+}
+
+// FileRegisterSchemeContext is like FileRegisterScheme
+// for openers that support cancellation.
+func FileRegisterSchemeContext(scheme string, opener FileContextOpenerFunc) {
+	if scheme == "" || opener == nil {
+		panic("scheme and opener must be set")
+	}
+	fileSchemes.Lock()
+	fileSchemes.openers[strings.ToLower(scheme)] = opener
+	fileSchemes.Unlock()
+}
+
+// fileContextOpener calls opener with the remaining time until the deadline of ctx.
+// Reads after ctx is done are stopped by FileOpenContext.
+func fileContextOpener(opener FileOpenerFunc) FileContextOpenerFunc {
+	return func(ctx context.Context, url string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var timeout time.Duration
+		if deadline, ok := ctx.Deadline(); ok {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				return nil, context.DeadlineExceeded
+			}
+		}
+		return opener(url, timeout)
+	}
+}
+
+// FileUnregisterScheme removes the opener of scheme.
+func FileUnregisterScheme(scheme string) {
+	fileSchemes.Lock()
+	delete(fileSchemes.openers, strings.ToLower(scheme))
+	fileSchemes.Unlock()
+}
+
+// FileSchemes returns the sorted list of registered schemes.
+func FileSchemes() []string {
+	fileSchemes.RLock()
+	defer fileSchemes.RUnlock()
+	result := make([]string, 0, len(fileSchemes.openers))
+	for scheme := range fileSchemes.openers {
+		result = append(result, scheme)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// FileOpen opens filenameOrURL for reading with the opener registered for its scheme.
+// Names without a registered scheme are opened as local files.
+// The first optional timeout limits opening and reading until Close.
+func FileOpen(filenameOrURL string, timeout ...time.Duration) (io.ReadCloser, error) {
+	ctx, cancel := fileTimeoutContext(timeout)
+	reader, err := FileOpenContext(ctx, filenameOrURL)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelReadCloser{ReadCloser: reader, cancel: cancel}, nil
+}
+
+// FileOpenContext is like FileOpen, but reads of the result
+// return ctx.Err() after ctx is done.
+func FileOpenContext(ctx context.Context, filenameOrURL string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	if path, ok := fileLocalPath(filenameOrURL); ok {
+		file, err := fileOpenLocal(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		reader = file
+	} else {
+		opener, err := fileOpenerOf(filenameOrURL)
+		if err != nil {
+			return nil, err
+		}
+		reader, err = opener(ctx, filenameOrURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &cancelReadCloser{ReadCloser: reader, ctx: ctx}, nil
+}
+
+// fileSchemeOf returns the lowercased scheme of filenameOrURL,
+// or an empty string if there is no syntactically valid one.
+// Single letter schemes are ignored, so windows paths like C:\dir
+// are not mistaken for URLs.
+func fileSchemeOf(filenameOrURL string) string {
+	i := strings.IndexByte(filenameOrURL, ':')
+	if i < 2 {
+		return ""
+	}
+	for j, c := range filenameOrURL[:i] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case j > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return ""
+		}
+	}
+	return strings.ToLower(filenameOrURL[:i])
+}
+
+func fileOpenerOf(filenameOrURL string) (FileContextOpenerFunc, error) {
+	scheme := fileSchemeOf(filenameOrURL)
+	fileSchemes.RLock()
+	opener, ok := fileSchemes.openers[scheme]
+	fileSchemes.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported URL scheme '%s'", scheme)
+	}
+	return opener, nil
+}
+
+// fileLocalPath returns the local path of filenameOrURL if it is a plain filename
+// or a file:// URL. ok is false if filenameOrURL must be opened by a scheme opener.
+func fileLocalPath(filenameOrURL string) (path string, ok bool) {
+	if strings.HasPrefix(filenameOrURL, "file://") {
+		return filenameOrURL[len("file://"):], true
+	}
+	scheme := fileSchemeOf(filenameOrURL)
+	if scheme == "" {
+		return filenameOrURL, true
+	}
+	if strings.HasPrefix(filenameOrURL[len(scheme)+1:], "//") {
+		// unknown schemes return an error from fileOpenerOf
+		return filenameOrURL, false
+	}
+	// without "//" it is a filename containing ':' like "notes:2020.txt",
+	// data URIs are the exception
+	if scheme != "data" {
+		return filenameOrURL, true
+	}
+	fileSchemes.RLock()
+	_, registered := fileSchemes.openers[scheme]
+	fileSchemes.RUnlock()
+	return filenameOrURL, !registered
+}
+
+func fileOpenLocalURL(ctx context.Context, url string) (io.ReadCloser, error) {
+	file, err := fileOpenLocal(ctx, strings.TrimPrefix(url, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func fileOpenLocal(ctx context.Context, path string) (*os.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// fileOpenHTTP goes through FileHTTP at call time,
+// so replacing FileHTTP affects all FileGet* helpers.
+func fileOpenHTTP(ctx context.Context, url string) (io.ReadCloser, error) {
+	return FileHTTP.Open(ctx, url)
+}
+
+// fileOpenData opens RFC 2397 data URIs: data:[<mediatype>][;base64],<data>
+func fileOpenData(_ context.Context, uri string) (io.ReadCloser, error) {
+	data, _, err := FileParseDataURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// FileParseDataURI decodes a RFC 2397 data URI and returns its payload and media type.
+// If the URI doesn't specify a media type, "text/plain;charset=US-ASCII" is returned.
+func FileParseDataURI(uri string) (data []byte, mediaType string, err error) {
+	if fileSchemeOf(uri) != "data" {
+		return nil, "", fmt.Errorf("not a data URI")
+	}
+	comma := strings.IndexByte(uri, ',')
+	if comma == -1 {
+		return nil, "", fmt.Errorf("data URI has no ',' separator")
+	}
+	header, payload := uri[len("data:"):comma], uri[comma+1:]
+
+	isBase64 := false
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		isBase64 = true
+		header = header[:len(header)-len(";base64")]
+	}
+	mediaType = header
+	if mediaType == "" || strings.HasPrefix(mediaType, ";") {
+		mediaType = "text/plain" + mediaType
+		if !strings.Contains(mediaType, ";charset=") {
+			mediaType += ";charset=US-ASCII"
+		}
+	}
+
+	payload, err = url.PathUnescape(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isBase64 {
+		return []byte(payload), mediaType, nil
+	}
+	data, err = base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		// some encoders strip the padding
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, mediaType, nil
+}
+
+// FileMem is the in memory filesystem behind the "mem://" scheme.
+// Useful for tests which shouldn't touch disk or network.
+var FileMem = NewMemFS()
+
+// MemFS is a concurrency safe in memory filesystem.
+// Names are used as given, a "mem://" prefix is ignored.
+type MemFS struct {
+	mutex sync.RWMutex
+	files map[string]memFile
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]memFile)}
+}
+
+func memFSName(name string) string {
+	return strings.TrimPrefix(name, "mem://")
+}
+
+// WriteFile stores a copy of data under name.
+func (fs *MemFS) WriteFile(name string, data []byte) {
+	file := memFile{data: append([]byte(nil), data...), modTime: time.Now()}
+	fs.mutex.Lock()
+	fs.files[memFSName(name)] = file
+	fs.mutex.Unlock()
+}
+
+// ReadFile returns a copy of the data stored under name.
+// The error satisfies os.IsNotExist if there is no such file.
+func (fs *MemFS) ReadFile(name string) ([]byte, error) {
+	fs.mutex.RLock()
+	file, ok := fs.files[memFSName(name)]
+	fs.mutex.RUnlock()
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), file.data...), nil
+}
+
+// ModTime returns the time name was written last,
+// or the zero time value if it doesn't exist.
+func (fs *MemFS) ModTime(name string) time.Time {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	return fs.files[memFSName(name)].modTime
+}
+
+// Exists returns true if there is a file with name.
+func (fs *MemFS) Exists(name string) bool {
+	fs.mutex.RLock()
+	_, ok := fs.files[memFSName(name)]
+	fs.mutex.RUnlock()
+	return ok
+}
+
+// Remove deletes name, it is no error if it doesn't exist.
+func (fs *MemFS) Remove(name string) {
+	fs.mutex.Lock()
+	delete(fs.files, memFSName(name))
+	fs.mutex.Unlock()
+}
+
+// Names returns the sorted names of all files.
+func (fs *MemFS) Names() []string {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	result := make([]string, 0, len(fs.files))
+	for name := range fs.files {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Open implements FileOpenerFunc, so a MemFS can be registered
+// for any scheme via FileRegisterScheme.
+func (fs *MemFS) Open(url string, _ time.Duration) (io.ReadCloser, error) {
+	if scheme := fileSchemeOf(url); scheme != "" {
+		url = strings.TrimPrefix(url[len(scheme)+1:], "//")
+	}
+	data, err := fs.ReadFile(url)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// fileChunkSize limits single reads of context aware helpers,
+// so cancellation is noticed even for huge local files.
+const fileChunkSize = 256 * 1024
+
+// fileTimeoutContext returns a context that is canceled after the first
+// optional timeout, or a cancelable background context if there is none.
+func fileTimeoutContext(timeout []time.Duration) (context.Context, context.CancelFunc) {
+	if len(timeout) > 0 && timeout[0] > 0 {
+		return context.WithTimeout(context.Background(), timeout[0])
+	}
+	return context.WithCancel(context.Background())
+}
+
+// cancelReadCloser checks ctx before every read
+// and calls cancel (if set) on Close.
+type cancelReadCloser struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *cancelReadCloser) Read(p []byte) (int, error) {
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > fileChunkSize {
+		p = p[:fileChunkSize]
+	}
+	return r.ReadCloser.Read(p)
+}
+
+func (r *cancelReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return err
+}
+
+// fileReadAllContext reads r until EOF in chunks of at most fileChunkSize
+// and stops with ctx.Err() as soon as ctx is done.
+// sizeHint is used to preallocate the result.
+func fileReadAllContext(ctx context.Context, r io.Reader, sizeHint int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if sizeHint > 0 && int64(int(sizeHint)) == sizeHint {
+		buf.Grow(int(sizeHint) + bytes.MinRead)
+	}
+	_, err := buf.ReadFrom(&cancelReadCloser{ReadCloser: ioutil.NopCloser(r), ctx: ctx})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileParseDataURI(t *testing.T) {
+	for _, tt := range []struct {
+		uri       string
+		data      string
+		mediaType string
+	}{
+		{"data:,Hello%2C%20World!", "Hello, World!", "text/plain;charset=US-ASCII"},
+		{"data:text/plain;base64,SGVsbG8sIFdvcmxkIQ==", "Hello, World!", "text/plain"},
+		{"data:application/json;base64,eyJhIjoxfQ", `{"a":1}`, "application/json"},
+		{"data:;charset=utf-8,abc", "abc", "text/plain;charset=utf-8"},
+	} {
+		data, mediaType, err := FileParseDataURI(tt.uri)
+		require.NoError(t, err, tt.uri)
+		require.Equal(t, tt.data, string(data))
+		require.Equal(t, tt.mediaType, mediaType)
+	}
+
+	_, _, err := FileParseDataURI("data:text/plain")
+	require.Error(t, err)
+}
+
+func Test_FileSchemes(t *testing.T) {
+	FileMem.WriteFile("mem://config.json", []byte(`{"a": [1, 2]}`))
+	defer FileMem.Remove("config.json")
+
+	var result struct{ A []int }
+	require.NoError(t, FileUnmarshallJSON("mem://config.json", &result))
+	require.Equal(t, []int{1, 2}, result.A)
+
+	lines, err := FileGetLines("data:,a%0Ab%0D%0Ac")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, lines)
+
+	_, err = FileGetBytes("mem://missing")
+	require.True(t, os.IsNotExist(err))
+
+	_, err = FileGetBytes("unknown://host/file")
+	require.Error(t, err)
+
+	FileRegisterScheme("upper", func(url string, _ time.Duration) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(strings.ToUpper(url))), nil
+	})
+	defer FileUnregisterScheme("upper")
+	require.Contains(t, FileSchemes(), "upper")
+
+	str, err := FileGetString("UPPER://abc")
+	require.NoError(t, err)
+	require.Equal(t, "UPPER://ABC", str)
+
+	sum, err := FileMD5String("upper://x")
+	require.NoError(t, err)
+	require.Equal(t, BytesMD5("UPPER://X"), sum)
+
+	// the deadline of the context is the timeout of the opener
+	var timeout time.Duration
+	FileRegisterScheme("timeout", func(url string, t time.Duration) (io.ReadCloser, error) {
+		timeout = t
+		return ioutil.NopCloser(strings.NewReader(url)), nil
+	})
+	defer FileUnregisterScheme("timeout")
+	_, err = FileGetBytes("timeout://x", time.Minute)
+	require.NoError(t, err)
+	require.True(t, timeout > 0 && timeout <= time.Minute, "%v", timeout)
+	_, err = FileGetBytes("timeout://x")
+	require.NoError(t, err)
+	require.Zero(t, timeout)
+
+	FileRegisterSchemeContext("ctx", func(ctx context.Context, url string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(url)), ctx.Err()
+	})
+	defer FileUnregisterScheme("ctx")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = FileGetBytesContext(ctx, "ctx://x")
+	require.Equal(t, context.Canceled, err)
+}
+
+func Test_fileLocalPath(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		path  string
+		local bool
+	}{
+		{"file:///etc/hosts", "/etc/hosts", true},
+		{"/etc/hosts", "/etc/hosts", true},
+		{`C:\Windows`, `C:\Windows`, true},
+		{"notes:2020.txt", "notes:2020.txt", true},
+		{"http://example.com", "", false},
+		{"data:,abc", "", false},
+		{"mem://a", "", false},
+		{"mem:notes", "mem:notes", true},
+		{"MEM:notes", "MEM:notes", true},
+		{"upper:x", "upper:x", true},
+		{"unknown://host/file", "", false},
+	} {
+		path, local := fileLocalPath(tt.name)
+		require.Equal(t, tt.local, local, tt.name)
+		if local {
+			require.Equal(t, tt.path, path)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileTail returns at most the last numLines lines of filenameOrURL in file order,
+// no lines if numLines is not positive.
+// Local files are read backwards in blocks, so only the tail is loaded
+// and lines can have any length. Other URLs are read completely.
+// \n is used to detect line ends, a preceding \r will be stripped away.
+// The first optional timeout limits the whole operation.
+func FileTail(filenameOrURL string, numLines int, timeout ...time.Duration) (lines []string, err error) {
+	ctx, cancel := fileTimeoutContext(timeout)
+	defer cancel()
+	return FileTailContext(ctx, filenameOrURL, numLines)
+}
+
+func FileTailContext(ctx context.Context, filenameOrURL string, numLines int) (lines []string, err error) {
+	if numLines <= 0 {
+		return nil, nil
+	}
+
+	path, ok := fileLocalPath(filenameOrURL)
+	if !ok {
+		data, err := FileGetBytesContext(ctx, filenameOrURL)
+		if err != nil {
+			return nil, err
+		}
+		return fileTailLines(data, numLines), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := fileTailOffset(ctx, file, info.Size(), numLines)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fileReadAllContext(ctx, io.NewSectionReader(file, offset, info.Size()-offset), info.Size()-offset)
+	if err != nil {
+		return nil, err
+	}
+	return fileTailLines(data, numLines), nil
+}
+
+// fileTailBlockSize is the size of the blocks read backwards by fileTailOffset.
+const fileTailBlockSize = 64 * 1024
+
+// fileTailOffset returns the offset where the last numLines lines of file begin.
+// A newline at the very end of the file doesn't start another line.
+func fileTailOffset(ctx context.Context, file io.ReaderAt, size int64, numLines int) (int64, error) {
+	block := make([]byte, fileTailBlockSize)
+	found := 0
+	for end := size; end > 0; {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		start := end - fileTailBlockSize
+		if start < 0 {
+			start = 0
+		}
+		b := block[:end-start]
+		if _, err := file.ReadAt(b, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			found++
+			if found == numLines {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// fileTailLines returns the last numLines lines of data in file order
+// using BytesTail. A terminating newline doesn't produce an empty last line.
+func fileTailLines(data []byte, numLines int) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines, _ := BytesTail(bytes.TrimSuffix(data, []byte{'\n'}), numLines)
+	// BytesTail returns the last line first and keeps \r of the outer lines
+	for i, j := 0, len(lines)-1; i <= j; i, j = i+1, j-1 {
+		lines[i], lines[j] = strings.TrimSuffix(lines[j], "\r"), strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines
+}
+
+// FileFollowOptions configures a FileFollower.
+type FileFollowOptions struct {
+	// Lines is the number of already existing lines to emit first, like tail -n.
+	// Ignored if FromStart is set.
+	Lines int
+	// FromStart emits the whole existing content first.
+	FromStart bool
+	// PollInterval is the time between checks for new data, rotation and truncation.
+	// Defaults to 250ms.
+	PollInterval time.Duration
+}
+
+// FileFollower reads lines appended to a file like tail -F.
+// It follows the name, not the opened file: if the file gets rotated
+// (renamed or removed and recreated) the new file is read from the start,
+// if it gets truncated reading restarts at the beginning.
+//
+// Usage example:
+//
+//	follower, err := NewFileFollower("/var/log/app.log")
+//	if err != nil {
+//		return err
+//	}
+//	defer follower.Close()
+//	for follower.Next(ctx) {
+//		fmt.Println(follower.Line())
+//	}
+//	return follower.Err()
+type FileFollower struct {
+	filename string
+	options  FileFollowOptions
+
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial []byte
+	// rotated is the new file, which is switched to
+	// after the old one has been read to the end
+	rotated *os.File
+
+	line string
+	err  error
+}
+
+// NewFileFollower opens filename and positions the follower
+// according to the first optional options.
+func NewFileFollower(filename string, options ...FileFollowOptions) (*FileFollower, error) {
+	f := &FileFollower{filename: filename}
+	if len(options) > 0 {
+		f.options = options[0]
+	}
+	if f.options.PollInterval <= 0 {
+		f.options.PollInterval = 250 * time.Millisecond
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	var offset int64
+	switch {
+	case f.options.FromStart:
+	case f.options.Lines > 0:
+		offset, err = fileTailOffset(context.Background(), file, info.Size(), f.options.Lines)
+	default:
+		offset = info.Size()
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.setFile(file, offset)
+	return f, nil
+}
+
+func (f *FileFollower) setFile(file *os.File, offset int64) {
+	f.file = file
+	f.offset = offset
+	f.reader = bufio.NewReader(file)
+}
+
+// Next waits until the next complete line is available and returns true,
+// or returns false if ctx is done or an error occurred.
+// Err returns the reason afterwards.
+func (f *FileFollower) Next(ctx context.Context) bool {
+	if f.err != nil {
+		return false
+	}
+	for {
+		chunk, err := f.reader.ReadSlice('\n')
+		f.offset += int64(len(chunk))
+		f.partial = append(f.partial, chunk...)
+		switch err {
+		case nil:
+			f.emit()
+			return true
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+		default:
+			f.err = err
+			return false
+		}
+
+		if f.rotated != nil {
+			f.file.Close()
+			f.setFile(f.rotated, 0)
+			f.rotated = nil
+			if len(f.partial) > 0 {
+				f.emit()
+				return true
+			}
+			continue
+		}
+
+		changed, err := f.checkFile()
+		if err != nil {
+			f.err = err
+			return false
+		}
+		if changed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			f.err = ctx.Err()
+			return false
+		case <-time.After(f.options.PollInterval):
+		}
+	}
+}
+
+func (f *FileFollower) emit() {
+	line := bytes.TrimSuffix(f.partial, []byte{'\n'})
+	f.line = string(bytes.TrimSuffix(line, []byte{'\r'}))
+	f.partial = f.partial[:0]
+}
+
+// checkFile detects truncation and rotation of the followed file.
+// changed is true if there may be new data to read.
+func (f *FileFollower) checkFile() (changed bool, err error) {
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(f.filename)
+	if os.IsNotExist(err) {
+		// rotation in progress, wait for the new file
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(current, info) {
+		file, err := os.Open(f.filename)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// drain lines written to the old file right before the rotation first
+		f.rotated = file
+		return true, nil
+	}
+
+	if info.Size() < f.offset {
+		if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.setFile(f.file, 0)
+		f.partial = f.partial[:0]
+		return true, nil
+	}
+	return false, nil
+}
+
+// Line returns the line read by the last successful call of Next,
+// without the line terminator.
+func (f *FileFollower) Line() string {
+	return f.line
+}
+
+// Err returns the error that stopped Next.
+func (f *FileFollower) Err() error {
+	return f.err
+}
+
+// Close closes the followed file.
+func (f *FileFollower) Close() error {
+	if f.err == nil {
+		f.err = os.ErrClosed
+	}
+	if f.rotated != nil {
+		f.rotated.Close()
+	}
+	return f.file.Close()
+}
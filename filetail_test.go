@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileTail(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	long := strings.Repeat("x", 3*fileTailBlockSize)
+
+	require.NoError(t, FileSetString(filename, "one\r\ntwo\n"+long+"\nfour\n"))
+	lines, err := FileTail(filename, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{long, "four"}, lines)
+
+	lines, err = FileTail(filename, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two", long, "four"}, lines)
+
+	line, err := FileGetLastLine(filename)
+	require.NoError(t, err)
+	require.Equal(t, "", line)
+
+	require.NoError(t, FileSetString(filename, "one\n"+long))
+	line, err = FileGetLastLine(filename)
+	require.NoError(t, err)
+	require.Equal(t, long, line)
+
+	lines, err = FileTail("data:,a%0Ab%0Ac%0A", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, lines)
+
+	require.NoError(t, FileSetString(filename, ""))
+	lines, err = FileTail(filename, 2)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	require.NoError(t, FileSetString(filename, "a\r\nb\r\n"))
+	lines, err = FileTail(filename, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, lines)
+	lines, err = FileTail(filename, 0)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+	lines, err = FileTail(filename, -1)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+}
+
+func Test_FileFollower(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, FileSetString(filename, "old1\nold2\n"))
+
+	follower, err := NewFileFollower(filename, FileFollowOptions{Lines: 1, PollInterval: 5 * time.Millisecond})
+	require.NoError(t, err)
+	defer follower.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	next := func() string {
+		require.True(t, follower.Next(ctx), "%v", follower.Err())
+		return follower.Line()
+	}
+
+	require.Equal(t, "old2", next())
+
+	require.NoError(t, FileAppendString(filename, "new1\nnew"))
+	require.Equal(t, "new1", next())
+	require.NoError(t, FileAppendString(filename, "2\r\n"))
+	require.Equal(t, "new2", next())
+
+	// rotation: lines written before the rename must not get lost
+	require.NoError(t, FileAppendString(filename, "before rotation\n"))
+	require.NoError(t, os.Rename(filename, filename+".1"))
+	require.NoError(t, FileSetString(filename, "rotated\n"))
+	require.Equal(t, "before rotation", next())
+	require.Equal(t, "rotated", next())
+
+	// truncation
+	require.NoError(t, FileSetString(filename, "x\n"))
+	require.Equal(t, "x", next())
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer shortCancel()
+	require.False(t, follower.Next(shortCtx))
+	require.Equal(t, context.DeadlineExceeded, follower.Err())
+}
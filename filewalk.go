@@ -0,0 +1,382 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileWalkEntry is a file or directory found by FileWalk.
+type FileWalkEntry struct {
+	// Path is the root directory joined with RelPath.
+	Path string
+	// RelPath is the slash separated path relative to the root directory.
+	RelPath string
+	// Info is from os.Lstat, or os.Stat for followed symlinks.
+	Info os.FileInfo
+}
+
+// FileWalkOptions configures FileWalk.
+type FileWalkOptions struct {
+	// Patterns limits the result to entries with a relative path matching
+	// at least one of the patterns, see FileGlobMatch.
+	// Directories are traversed anyway.
+	Patterns []string
+	// Exclude are gitignore style patterns relative to the root directory.
+	// Excluded directories are not traversed.
+	Exclude []string
+	// ExcludeFiles are names of gitignore style files, like ".gitignore",
+	// that are read in every directory. Their patterns apply
+	// to the directory they are in.
+	ExcludeFiles []string
+	// MaxDepth limits the traversal, 1 only returns the entries of the root directory.
+	// Zero means no limit.
+	MaxDepth int
+	// FollowSymlinks traverses linked directories and returns
+	// the info of link targets. Symlink loops are reported as errors.
+	FollowSymlinks bool
+	// SkipFiles only returns directories.
+	SkipFiles bool
+	// SkipDirs only returns files and symlinks.
+	SkipDirs bool
+	// Parallel is the number of directories read at the same time.
+	// The result is always in the same order as a sequential walk.
+	Parallel int
+}
+
+// FileWalk returns all entries below root, sorted like
+// a depth first walk visiting names in lexical order.
+// Unreadable directories and symlink loops don't stop the walk,
+// they are returned as ErrorList together with everything found.
+// Example:
+//
+//	entries, err := FileWalk("project", FileWalkOptions{
+//		Patterns:     []string{"**/*.go"},
+//		ExcludeFiles: []string{".gitignore"},
+//	})
+func FileWalk(root string, options ...FileWalkOptions) ([]FileWalkEntry, error) {
+	var opts FileWalkOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("'%s' is not a directory", root)
+	}
+
+	w := &fileWalker{opts: &opts}
+	rootJob := fileWalkDir{path: root, rules: fileIgnoreParse("", opts.Exclude)}
+	if opts.FollowSymlinks {
+		resolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return nil, err
+		}
+		rootJob.ancestors = []string{resolved}
+	}
+
+	if opts.Parallel > 1 {
+		w.sem = make(chan struct{}, opts.Parallel)
+		w.wg.Add(1)
+		go w.walkParallel(rootJob)
+		w.wg.Wait()
+		sort.Slice(w.entries, func(i, j int) bool {
+			return fileWalkLess(w.entries[i].RelPath, w.entries[j].RelPath)
+		})
+	} else {
+		w.walk(rootJob)
+	}
+	return w.entries, w.errs.Err()
+}
+
+type fileWalker struct {
+	opts *FileWalkOptions
+
+	mutex   sync.Mutex
+	entries []FileWalkEntry
+	errs    ErrorList
+
+	// parallel mode only
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+type fileWalkDir struct {
+	path  string
+	rel   string
+	depth int
+	rules []fileIgnoreRule
+	// resolved paths of all parent directories to detect symlink loops
+	ancestors []string
+}
+
+// fileWalkLess compares slash separated paths segment by segment,
+// so all entries of a directory sort before the next sibling.
+func fileWalkLess(a, b string) bool {
+	for {
+		aSeg, aRest := StringSplitOnceChar(a, '/')
+		bSeg, bRest := StringSplitOnceChar(b, '/')
+		if aSeg != bSeg {
+			return aSeg < bSeg
+		}
+		if aRest == "" || bRest == "" {
+			return aRest == "" && bRest != ""
+		}
+		a, b = aRest, bRest
+	}
+}
+
+func (w *fileWalker) addError(err error) {
+	w.mutex.Lock()
+	w.errs = append(w.errs, err)
+	w.mutex.Unlock()
+}
+
+// read returns the matching entries of dir and its sub directories to traverse.
+// In sequential mode, sub directories are traversed immediately to keep the order.
+func (w *fileWalker) read(dir fileWalkDir, sequential bool) (subDirs []fileWalkDir) {
+	children, err := ioutil.ReadDir(dir.path)
+	if err != nil {
+		w.addError(err)
+		return nil
+	}
+
+	rules := dir.rules
+	for _, name := range w.opts.ExcludeFiles {
+		lines, err := FileGetLines(filepath.Join(dir.path, name))
+		if err == nil {
+			rules = append(rules[:len(rules):len(rules)], fileIgnoreParse(dir.rel, lines)...)
+		}
+	}
+
+	for _, info := range children {
+		entry := FileWalkEntry{
+			Path:    filepath.Join(dir.path, info.Name()),
+			RelPath: path.Join(dir.rel, info.Name()),
+			Info:    info,
+		}
+		if info.Mode()&os.ModeSymlink != 0 && w.opts.FollowSymlinks {
+			target, err := os.Stat(entry.Path)
+			if err != nil {
+				w.addError(err)
+				continue
+			}
+			entry.Info = target
+		}
+		isDir := entry.Info.IsDir()
+		if fileIgnored(rules, entry.RelPath, isDir) {
+			continue
+		}
+
+		if (isDir && !w.opts.SkipDirs || !isDir && !w.opts.SkipFiles) &&
+			(len(w.opts.Patterns) == 0 || fileGlobMatchAny(w.opts.Patterns, entry.RelPath)) {
+			w.mutex.Lock()
+			w.entries = append(w.entries, entry)
+			w.mutex.Unlock()
+		}
+
+		if !isDir || (w.opts.MaxDepth > 0 && dir.depth+1 >= w.opts.MaxDepth) {
+			continue
+		}
+		sub := fileWalkDir{path: entry.Path, rel: entry.RelPath, depth: dir.depth + 1, rules: rules}
+		if w.opts.FollowSymlinks {
+			resolved, err := filepath.EvalSymlinks(entry.Path)
+			if err != nil {
+				w.addError(err)
+				continue
+			}
+			if StringInSlice(resolved, dir.ancestors) {
+				w.addError(fmt.Errorf("symlink loop at '%s'", entry.Path))
+				continue
+			}
+			sub.ancestors = append(dir.ancestors[:len(dir.ancestors):len(dir.ancestors)], resolved)
+		}
+		if sequential {
+			w.walk(sub)
+		} else {
+			subDirs = append(subDirs, sub)
+		}
+	}
+	return subDirs
+}
+
+func (w *fileWalker) walk(dir fileWalkDir) {
+	w.read(dir, true)
+}
+
+func (w *fileWalker) walkParallel(dir fileWalkDir) {
+	defer w.wg.Done()
+	w.sem <- struct{}{}
+	subDirs := w.read(dir, false)
+	<-w.sem
+	for _, sub := range subDirs {
+		w.wg.Add(1)
+		go w.walkParallel(sub)
+	}
+}
+
+// FileGlobMatch reports if the slash separated relPath matches pattern.
+// Pattern segments are matched with path.Match, a "**" segment
+// matches any number of segments including none.
+func FileGlobMatch(pattern, relPath string) bool {
+	return fileGlobMatchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func fileGlobMatchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(segments); skip++ {
+				if fileGlobMatchSegments(pattern[1:], segments[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func fileGlobMatchAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if FileGlobMatch(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHasGlobMeta reports if s contains characters special to path.Match.
+func fileHasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// FileGlob returns the sorted paths matching pattern, which can
+// contain "**" segments, see FileGlobMatch.
+// Pattern segments are separated by slashes on all systems.
+func FileGlob(pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	static := 0
+	for static < len(segments)-1 && !fileHasGlobMeta(segments[static]) {
+		static++
+	}
+	if !fileHasGlobMeta(segments[static]) {
+		if _, err := os.Lstat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	root := "."
+	if static > 0 {
+		root = filepath.FromSlash(strings.Join(segments[:static], "/"))
+		if root == "" {
+			root = string(filepath.Separator)
+		}
+	}
+	if !FileIsDir(root) {
+		return nil, nil
+	}
+	rest := segments[static:]
+	opts := FileWalkOptions{Patterns: []string{strings.Join(rest, "/")}}
+	if !StringInSlice("**", rest) {
+		opts.MaxDepth = len(rest)
+	}
+	entries, err := FileWalk(root, opts)
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		if static == 0 {
+			paths[i] = filepath.FromSlash(entry.RelPath)
+		} else {
+			paths[i] = entry.Path
+		}
+	}
+	return paths, err
+}
+
+// fileIgnoreRule is a line of a gitignore style file.
+type fileIgnoreRule struct {
+	base     string // slash separated directory the rule applies to, "" for the root
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // pattern contains a slash and is relative to base
+}
+
+// fileIgnoreParse parses gitignore style lines.
+func fileIgnoreParse(base string, lines []string) []fileIgnoreRule {
+	var rules []fileIgnoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule := fileIgnoreRule{base: base}
+		switch {
+		case line[0] == '!':
+			rule.negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// fileIgnored reports if the last rule matching relPath excludes it.
+func fileIgnored(rules []fileIgnoreRule, relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		sub := relPath
+		if rule.base != "" {
+			if !strings.HasPrefix(relPath, rule.base+"/") {
+				continue
+			}
+			sub = relPath[len(rule.base)+1:]
+		}
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		var match bool
+		if rule.anchored {
+			match = FileGlobMatch(rule.pattern, sub)
+		} else {
+			match = FileGlobMatch(rule.pattern, path.Base(sub))
+		}
+		if match {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
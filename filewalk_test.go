@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileGlobMatch(t *testing.T) {
+	require.True(t, FileGlobMatch("**/*.go", "a.go"))
+	require.True(t, FileGlobMatch("**/*.go", "a/b/c.go"))
+	require.True(t, FileGlobMatch("a/**/c", "a/c"))
+	require.True(t, FileGlobMatch("a/**/c", "a/b/b/c"))
+	require.True(t, FileGlobMatch("a/**", "a/b/c"))
+	require.False(t, FileGlobMatch("*.go", "a/b.go"))
+	require.False(t, FileGlobMatch("a/**/c", "a/b/d"))
+}
+
+func testWalkRelPaths(entries []FileWalkEntry) []string {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = entry.RelPath
+	}
+	return paths
+}
+
+func Test_FileWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "a.txt", "a/b.go", "a/c/d.go", "a/c/e.log", "build/x.go", "z/keep.log"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755))
+		require.NoError(t, FileSetString(filepath.Join(root, name), name))
+	}
+	require.NoError(t, FileSetString(filepath.Join(root, ".gitignore"), "# comment\n/build/\n*.log\n"))
+	require.NoError(t, FileSetString(filepath.Join(root, "z", ".gitignore"), "!keep.log\n"))
+
+	for _, parallel := range []int{0, 4} {
+		entries, err := FileWalk(root, FileWalkOptions{ExcludeFiles: []string{".gitignore"}, Parallel: parallel})
+		require.NoError(t, err)
+		require.Equal(t, []string{".gitignore", "a", "a/b.go", "a/c", "a/c/d.go", "a.go", "a.txt", "z", "z/.gitignore", "z/keep.log"}, testWalkRelPaths(entries))
+		require.Equal(t, filepath.Join(root, "a", "b.go"), entries[2].Path)
+		require.Equal(t, int64(len("a/b.go")), entries[2].Info.Size())
+	}
+
+	entries, err := FileWalk(root, FileWalkOptions{Patterns: []string{"**/*.go"}, Exclude: []string{"build"}, MaxDepth: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/b.go", "a.go"}, testWalkRelPaths(entries))
+
+	entries, err = FileWalk(root, FileWalkOptions{SkipFiles: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "a/c", "build", "z"}, testWalkRelPaths(entries))
+
+	matches, err := FileGlob(filepath.Join(root, "a", "**", "*.go"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(root, "a", "b.go"), filepath.Join(root, "a", "c", "d.go")}, matches)
+
+	found, ok := FileFindGlob([]string{filepath.Join(root, "missing"), filepath.Join(root, "a")}, "*.txt", "c/*.go")
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(root, "a", "c", "d.go"), found)
+	found, ok, modified := FileFindGlobModified([]string{root}, "a/c/*.go")
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(root, "a", "c", "d.go"), found)
+	require.False(t, modified.IsZero())
+
+	// FileFind takes names literally
+	_, ok = FileFind([]string{filepath.Join(root, "a")}, "c/*.go")
+	require.False(t, ok)
+	require.NoError(t, FileSetString(filepath.Join(root, "report[1].txt"), ""))
+	require.NoError(t, FileSetString(filepath.Join(root, "report1.txt"), ""))
+	found, ok = FileFind([]string{root}, "report[1].txt")
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(root, "report[1].txt"), found)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	require.NoError(t, os.Symlink("..", filepath.Join(root, "a", "c", "loop")))
+	entries, err = FileWalk(filepath.Join(root, "a"), FileWalkOptions{FollowSymlinks: true})
+	require.Error(t, err)
+	require.Equal(t, []string{"b.go", "c", "c/d.go", "c/e.log", "c/loop"}, testWalkRelPaths(entries))
+}
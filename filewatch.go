@@ -0,0 +1,415 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileWatchOp is the kind of change reported by a FileWatcher.
+type FileWatchOp int
+
+const (
+	FileCreated FileWatchOp = iota
+	FileModified
+	FileDeleted
+	// FileRenamed is reported if a file was moved inside the watched tree.
+	FileRenamed
+)
+
+func (op FileWatchOp) String() string {
+	switch op {
+	case FileCreated:
+		return "created"
+	case FileModified:
+		return "modified"
+	case FileDeleted:
+		return "deleted"
+	case FileRenamed:
+		return "renamed"
+	}
+	return fmt.Sprintf("FileWatchOp(%d)", int(op))
+}
+
+// FileWatchEvent is a change of a file or directory.
+type FileWatchEvent struct {
+	Op   FileWatchOp
+	Path string
+	// OldPath is the previous path of a renamed file.
+	OldPath string
+}
+
+func (e FileWatchEvent) String() string {
+	if e.Op == FileRenamed {
+		return fmt.Sprintf("%s %s -> %s", e.Op, e.OldPath, e.Path)
+	}
+	return fmt.Sprintf("%s %s", e.Op, e.Path)
+}
+
+// FileWatchOptions configures a FileWatcher.
+type FileWatchOptions struct {
+	// Recursive also watches all sub directories.
+	Recursive bool
+	// Include limits events to paths matching at least one of the filepath.Match
+	// patterns. Patterns are matched against the slash separated path
+	// relative to the watched directory and against the base name.
+	Include []string
+	// Exclude drops events of paths matching one of the patterns,
+	// also of everything inside matching directories.
+	Exclude []string
+	// Debounce merges all events of a path until there was no further
+	// event for this duration, so a file written in many chunks
+	// is only reported once. Zero reports every event.
+	Debounce time.Duration
+	// Polling compares the state of all files every PollInterval
+	// instead of using inotify. Polling is always used on other systems than Linux.
+	Polling bool
+	// PollInterval defaults to one second.
+	PollInterval time.Duration
+}
+
+// errFileWatchUnsupported is returned by fileWatchNotify
+// if there is no notification API.
+var errFileWatchUnsupported = errors.New("file notifications not supported")
+
+/*
+FileWatcher reports changes of a file or a directory tree.
+Example for reloading a config file:
+
+	watcher, err := NewFileWatcher("config.json", FileWatchOptions{Debounce: 100 * time.Millisecond})
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for event := range watcher.Events {
+		if event.Op != FileDeleted {
+			reloadConfig()
+		}
+	}
+
+Watching a single file watches its directory, so replacing the file
+with a renamed temporary file (see FileAtomic) is detected too.
+Depending on the system this is reported as FileCreated or FileModified.
+*/
+type FileWatcher struct {
+	// Events is closed by Close.
+	Events <-chan FileWatchEvent
+	// Errors receives errors of the underlying system API.
+	// Errors are dropped if nobody receives them.
+	Errors <-chan error
+
+	root    string
+	only    string // base name if a single file is watched
+	options FileWatchOptions
+
+	events    chan FileWatchEvent
+	errors    chan error
+	raw       chan FileWatchEvent
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeAPI  func() error
+}
+
+// NewFileWatcher starts watching filename, which can be a file or a directory.
+func NewFileWatcher(filename string, options ...FileWatchOptions) (*FileWatcher, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := &FileWatcher{
+		root:   filename,
+		events: make(chan FileWatchEvent, 64),
+		errors: make(chan error, 16),
+		raw:    make(chan FileWatchEvent, 64),
+		done:   make(chan struct{}),
+	}
+	w.Events, w.Errors = w.events, w.errors
+	if len(options) > 0 {
+		w.options = options[0]
+	}
+	if !info.IsDir() {
+		w.root, w.only = filepath.Dir(filename), filepath.Base(filename)
+		w.options.Recursive = false
+	}
+
+	w.wg.Add(1)
+	go w.dispatch()
+
+	if !w.options.Polling {
+		w.closeAPI, err = fileWatchNotify(w)
+		if err != nil && err != errFileWatchUnsupported {
+			w.closeAPI = func() error { return nil }
+			w.Close()
+			return nil, err
+		}
+	}
+	if w.closeAPI == nil {
+		w.closeAPI = w.poll()
+	}
+	return w, nil
+}
+
+// Close stops watching and closes Events and Errors.
+func (w *FileWatcher) Close() (err error) {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.closeAPI()
+		w.wg.Wait()
+		close(w.errors)
+	})
+	return err
+}
+
+// send passes an event to the dispatcher and returns false
+// if the watcher was closed.
+func (w *FileWatcher) send(event FileWatchEvent) bool {
+	select {
+	case w.raw <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *FileWatcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// matches reports if path passes the filters of the watcher.
+func (w *FileWatcher) matches(p string) bool {
+	rel, err := filepath.Rel(w.root, p)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if w.only != "" {
+		return rel == w.only
+	}
+	for dir := rel; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if fileCopyMatches(w.options.Exclude, dir) {
+			return false
+		}
+	}
+	return len(w.options.Include) == 0 || fileCopyMatches(w.options.Include, rel)
+}
+
+// filter applies the filters to event, renames from or to
+// filtered paths become creations or deletions.
+func (w *FileWatcher) filter(event FileWatchEvent) (FileWatchEvent, bool) {
+	if event.Op != FileRenamed {
+		return event, w.matches(event.Path)
+	}
+	newOK, oldOK := w.matches(event.Path), w.matches(event.OldPath)
+	switch {
+	case newOK && oldOK:
+		return event, true
+	case newOK:
+		return FileWatchEvent{Op: FileCreated, Path: event.Path}, true
+	case oldOK:
+		return FileWatchEvent{Op: FileDeleted, Path: event.OldPath}, true
+	}
+	return event, false
+}
+
+// fileWatchMerge combines a pending event with a later one of the same path.
+// keep is false if the events cancel each other out.
+func fileWatchMerge(pending, event FileWatchEvent) (merged FileWatchEvent, keep bool) {
+	switch {
+	case pending.Op == FileCreated && event.Op == FileModified:
+		return pending, true
+	case pending.Op == FileCreated && event.Op == FileDeleted:
+		return event, false
+	case pending.Op == FileDeleted && event.Op == FileCreated:
+		event.Op = FileModified
+		return event, true
+	case pending.Op == FileRenamed && event.Op == FileModified:
+		return pending, true
+	}
+	return event, true
+}
+
+type fileWatchPending struct {
+	event FileWatchEvent
+	last  time.Time
+}
+
+func (w *FileWatcher) dispatch() {
+	defer w.wg.Done()
+	defer close(w.events)
+
+	emit := func(event FileWatchEvent) bool {
+		select {
+		case w.events <- event:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+
+	debounce := w.options.Debounce
+	var tick <-chan time.Time
+	if debounce > 0 {
+		ticker := time.NewTicker(debounce / 4)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	pending := make(map[string]*fileWatchPending)
+	var order []string
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case event := <-w.raw:
+			event, ok := w.filter(event)
+			if !ok {
+				continue
+			}
+			if debounce <= 0 {
+				if !emit(event) {
+					return
+				}
+				continue
+			}
+			p := pending[event.Path]
+			if p == nil {
+				pending[event.Path] = &fileWatchPending{event, time.Now()}
+				order = append(order, event.Path)
+				continue
+			}
+			var keep bool
+			p.event, keep = fileWatchMerge(p.event, event)
+			p.last = time.Now()
+			if !keep {
+				delete(pending, event.Path)
+			}
+
+		case now := <-tick:
+			remaining := order[:0]
+			for _, p := range order {
+				entry := pending[p]
+				switch {
+				case entry == nil:
+					// canceled out, or emitted and added again later in order
+				case now.Sub(entry.last) < debounce:
+					remaining = append(remaining, p)
+				default:
+					delete(pending, p)
+					if !emit(entry.event) {
+						return
+					}
+				}
+			}
+			order = remaining
+		}
+	}
+}
+
+// poll starts the polling fallback and returns its close function.
+func (w *FileWatcher) poll() func() error {
+	interval := w.options.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	snapshot := w.scan()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				next := w.scan()
+				for _, event := range fileWatchDiff(snapshot, next) {
+					if !w.send(event) {
+						return
+					}
+				}
+				snapshot = next
+			}
+		}
+	}()
+	return func() error { return nil }
+}
+
+// scan returns the state of all files below the watched directory.
+func (w *FileWatcher) scan() map[string]os.FileInfo {
+	files := make(map[string]os.FileInfo)
+	filepath.Walk(w.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files can vanish while walking
+			return nil
+		}
+		if p == w.root {
+			return nil
+		}
+		files[p] = info
+		if info.IsDir() && !w.options.Recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return files
+}
+
+// fileWatchDiff returns the events that lead from snapshot old to new.
+// Files are considered modified if their modification time, size or
+// identity changed, a deleted and a created file with the same
+// identity are reported as renamed.
+func fileWatchDiff(old, new map[string]os.FileInfo) []FileWatchEvent {
+	var created, deleted, events []FileWatchEvent
+	for p, info := range new {
+		oldInfo, ok := old[p]
+		switch {
+		case !ok:
+			created = append(created, FileWatchEvent{Op: FileCreated, Path: p})
+		case info.IsDir():
+			// directory times change with their entries, which are reported themselves
+		case !info.ModTime().Equal(oldInfo.ModTime()) || info.Size() != oldInfo.Size() || !os.SameFile(info, oldInfo):
+			events = append(events, FileWatchEvent{Op: FileModified, Path: p})
+		}
+	}
+	for p := range old {
+		if _, ok := new[p]; !ok {
+			deleted = append(deleted, FileWatchEvent{Op: FileDeleted, Path: p})
+		}
+	}
+
+	for d := range deleted {
+		for c := range created {
+			if created[c].Op == FileCreated && os.SameFile(old[deleted[d].Path], new[created[c].Path]) {
+				created[c] = FileWatchEvent{Op: FileRenamed, Path: created[c].Path, OldPath: deleted[d].Path}
+				deleted[d].Op = FileRenamed
+				break
+			}
+		}
+	}
+	for _, event := range deleted {
+		if event.Op == FileDeleted {
+			events = append(events, event)
+		}
+	}
+	events = append(events, created...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
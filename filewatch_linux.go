@@ -0,0 +1,192 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build linux
+
+package dry
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const fileInotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR | unix.IN_EXCL_UNLINK
+
+type fileInotify struct {
+	w    *FileWatcher
+	fd   int
+	file *os.File
+	dirs map[int]string // watch descriptor to directory
+}
+
+// fileWatchNotify starts watching with inotify and returns its close function.
+func fileWatchNotify(w *FileWatcher) (func() error, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errFileWatchUnsupported
+	}
+	// a non blocking file uses the runtime poller, so Close interrupts Read
+	in := &fileInotify{w: w, fd: fd, file: os.NewFile(uintptr(fd), "inotify"), dirs: make(map[int]string)}
+	if err = in.addDir(w.root, false); err != nil {
+		in.file.Close()
+		return nil, err
+	}
+	w.wg.Add(1)
+	go in.run()
+	return in.file.Close, nil
+}
+
+// addDir watches dir and, if recursive, all its sub directories.
+// If created is set, existing entries are reported as created, because
+// they could have been added before the watch was in place.
+func (in *fileInotify) addDir(dir string, created bool) error {
+	wd, err := unix.InotifyAddWatch(in.fd, dir, fileInotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	in.dirs[wd] = dir
+	if !in.w.options.Recursive && !created {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		if created && !in.w.send(FileWatchEvent{Op: FileCreated, Path: p}) {
+			return nil
+		}
+		if entry.IsDir() && in.w.options.Recursive {
+			if err = in.addDir(p, created); err != nil && !os.IsNotExist(errors.Unwrap(err)) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveDirs updates the paths of watched directories after oldDir was renamed to newDir,
+// or removes their watches if newDir is empty.
+func (in *fileInotify) moveDirs(oldDir, newDir string) {
+	for wd, dir := range in.dirs {
+		if dir != oldDir && !strings.HasPrefix(dir, oldDir+string(filepath.Separator)) {
+			continue
+		}
+		if newDir == "" {
+			unix.InotifyRmWatch(in.fd, uint32(wd))
+			delete(in.dirs, wd)
+		} else {
+			in.dirs[wd] = newDir + dir[len(oldDir):]
+		}
+	}
+}
+
+func (in *fileInotify) run() {
+	defer in.w.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := in.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				in.w.sendError(err)
+			}
+			return
+		}
+		if !in.handle(buf[:n]) {
+			return
+		}
+	}
+}
+
+// handle sends the events of buf and returns false if the watcher was closed.
+func (in *fileInotify) handle(buf []byte) bool {
+	// renames are reported as a pair of events with the same cookie,
+	// a move without partner left or entered the watched tree
+	type move struct {
+		path  string
+		isDir bool
+	}
+	moves := make(map[uint32]move)
+	var cookies []uint32
+
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		name := strings.TrimRight(string(buf[nameStart:nameStart+int(raw.Len)]), "\x00")
+		offset = nameStart + int(raw.Len)
+
+		if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+			in.w.sendError(errors.New("inotify event queue overflow, events were lost"))
+			continue
+		}
+		dir, ok := in.dirs[int(raw.Wd)]
+		if !ok {
+			continue
+		}
+		if raw.Mask&unix.IN_IGNORED != 0 {
+			delete(in.dirs, int(raw.Wd))
+			continue
+		}
+		p := filepath.Join(dir, name)
+		isDir := raw.Mask&unix.IN_ISDIR != 0
+
+		event := FileWatchEvent{Path: p}
+		switch {
+		case raw.Mask&unix.IN_CREATE != 0:
+			event.Op = FileCreated
+		case raw.Mask&unix.IN_DELETE != 0:
+			event.Op = FileDeleted
+		case raw.Mask&(unix.IN_MODIFY|unix.IN_ATTRIB) != 0:
+			if isDir || name == "" {
+				continue
+			}
+			event.Op = FileModified
+		case raw.Mask&unix.IN_MOVED_FROM != 0:
+			moves[raw.Cookie] = move{p, isDir}
+			cookies = append(cookies, raw.Cookie)
+			continue
+		case raw.Mask&unix.IN_MOVED_TO != 0:
+			if from, ok := moves[raw.Cookie]; ok {
+				delete(moves, raw.Cookie)
+				event = FileWatchEvent{Op: FileRenamed, Path: p, OldPath: from.path}
+				if isDir {
+					in.moveDirs(from.path, p)
+				}
+			} else {
+				event.Op = FileCreated
+			}
+		default:
+			continue
+		}
+		if !in.w.send(event) {
+			return false
+		}
+		if event.Op == FileCreated && isDir && in.w.options.Recursive {
+			if err := in.addDir(p, true); err != nil && !os.IsNotExist(errors.Unwrap(err)) {
+				in.w.sendError(err)
+			}
+		}
+	}
+
+	for _, cookie := range cookies {
+		if from, ok := moves[cookie]; ok {
+			if from.isDir {
+				in.moveDirs(from.path, "")
+			}
+			if !in.w.send(FileWatchEvent{Op: FileDeleted, Path: from.path}) {
+				return false
+			}
+		}
+	}
+	return true
+}
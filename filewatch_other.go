@@ -0,0 +1,13 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build !linux
+
+package dry
+
+// fileWatchNotify is only implemented for Linux, other systems use polling.
+func fileWatchNotify(w *FileWatcher) (func() error, error) {
+	return nil, errFileWatchUnsupported
+}
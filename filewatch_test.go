@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testWatchEvents receives count events or fails after a timeout.
+func testWatchEvents(t *testing.T, watcher *FileWatcher, count int) []FileWatchEvent {
+	t.Helper()
+	var events []FileWatchEvent
+	timeout := time.After(5 * time.Second)
+	for len(events) < count {
+		select {
+		case event := <-watcher.Events:
+			events = append(events, event)
+		case err := <-watcher.Errors:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("expected %d events, got %v", count, events)
+		}
+	}
+	return events
+}
+
+func Test_FileWatcher(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+		watcher, err := NewFileWatcher(dir, FileWatchOptions{
+			Recursive:    true,
+			Exclude:      []string{"*.tmp"},
+			Debounce:     50 * time.Millisecond,
+			Polling:      polling,
+			PollInterval: 20 * time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		a := filepath.Join(dir, "sub", "a.txt")
+		require.NoError(t, FileSetString(a, "a"))
+		require.NoError(t, FileAppendString(a, "more"))
+		require.NoError(t, FileSetString(filepath.Join(dir, "ignored.tmp"), "x"))
+		require.Equal(t, []FileWatchEvent{{Op: FileCreated, Path: a}}, testWatchEvents(t, watcher, 1), "polling %v", polling)
+
+		require.NoError(t, FileAppendString(a, "even more"))
+		require.Equal(t, []FileWatchEvent{{Op: FileModified, Path: a}}, testWatchEvents(t, watcher, 1), "polling %v", polling)
+
+		b := filepath.Join(dir, "b.txt")
+		require.NoError(t, os.Rename(a, b))
+		require.Equal(t, []FileWatchEvent{{Op: FileRenamed, Path: b, OldPath: a}}, testWatchEvents(t, watcher, 1), "polling %v", polling)
+
+		require.NoError(t, os.Remove(b))
+		require.Equal(t, []FileWatchEvent{{Op: FileDeleted, Path: b}}, testWatchEvents(t, watcher, 1), "polling %v", polling)
+
+		require.NoError(t, watcher.Close())
+		_, open := <-watcher.Events
+		require.False(t, open)
+	}
+}
+
+func Test_FileWatcherSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	require.NoError(t, FileSetString(config, "{}"))
+	watcher, err := NewFileWatcher(config, FileWatchOptions{Debounce: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	require.NoError(t, FileSetString(filepath.Join(dir, "other.json"), "{}"))
+	require.NoError(t, FileSetString(config, `{"a": 1}`, FileAtomic))
+	events := testWatchEvents(t, watcher, 1)
+	require.Equal(t, config, events[0].Path)
+	require.NotEqual(t, FileDeleted, events[0].Op)
+}
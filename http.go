@@ -6,6 +6,7 @@
 package dry
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
@@ -13,56 +14,422 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
-type wrappedResponseWriter struct {
-	io.Writer
-	http.ResponseWriter
-}
-
-func (wrapped wrappedResponseWriter) Write(data []byte) (int, error) {
-	return wrapped.Writer.Write(data)
-}
-
 // HTTPCompressHandlerFunc wraps a http.HandlerFunc so that the response gets
-// gzip or deflate compressed if the Accept-Encoding header of the request allows it.
+// compressed with the registered codec preferred by the Accept-Encoding header
+// of the request, see HTTPCompressHandler.
 func HTTPCompressHandlerFunc(handlerFunc http.HandlerFunc) http.HandlerFunc {
 	return func(response http.ResponseWriter, request *http.Request) {
 		NewHTTPCompressHandlerFromFunc(handlerFunc).ServeHTTP(response, request)
 	}
 }
 
-// HTTPCompressHandler wraps a http.Handler so that the response gets
-// gzip or deflate compressed if the Accept-Encoding header of the request allows it.
+// HTTPCompressibleContentTypes are the media types compressed
+// by NewHTTPCompressHandler and HTTPCompressHandlerFunc. Images other than SVG, audio, video
+// and archives are already compressed and not listed.
+var HTTPCompressibleContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/ld+json",
+	"application/manifest+json",
+	"application/geo+json",
+	"application/problem+json",
+	"application/javascript",
+	"application/x-javascript",
+	"application/ecmascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/problem+xml",
+	"application/graphql",
+	"application/wasm",
+	"application/x-ndjson",
+	"application/x-yaml",
+	"application/yaml",
+	"application/toml",
+	"application/vnd.ms-fontobject",
+	"application/x-font-ttf",
+	"font/ttf",
+	"font/otf",
+	"image/svg+xml",
+	"image/x-icon",
+	"image/vnd.microsoft.icon",
+	"image/bmp",
+}
+
+// HTTPCompressMinSize is the HTTPCompressHandler.MinSize set by NewHTTPCompressHandler.
+const HTTPCompressMinSize = 1024
+
+/*
+HTTPCompressHandler wraps a http.Handler so that the response gets
+compressed with the registered codec preferred by the Accept-Encoding header
+of the request, see RegisterCodec and HTTPNegotiateEncoding.
+
+The response is buffered up to MinSize bytes before deciding
+if it is compressed. Only responses with a Content-Type in ContentTypes
+are compressed, a missing Content-Type is detected like net/http does.
+NewHTTPCompressHandler and HTTPCompressHandlerFunc use HTTPCompressMinSize
+and HTTPCompressibleContentTypes, while the zero values of MinSize
+and ContentTypes compress responses of all sizes and types.
+Responses that already have a Content-Encoding, partial content,
+and responses to HEAD requests are not changed.
+Compressed responses have no Content-Length and strong ETags are made weak.
+Vary: Accept-Encoding is set for all responses that could be compressed.
+
+Flushing the response starts compressing immediately and flushes the codec,
+so server-sent events are streamed. The response writer passed to the handler
+implements http.Hijacker and http.Pusher if the wrapped one does,
+and has an Unwrap method for http.ResponseController.
+*/
 type HTTPCompressHandler struct {
 	http.Handler
+	// Encodings are the names of the offered codecs in order of preference,
+	// used if the client accepts several with the same quality.
+	// Defaults to all registered codecs with gzip and deflate last,
+	// so codecs like br are preferred once they are registered.
+	Encodings []string
+	// MinSize is the minimum size of a compressed response,
+	// zero or negative values compress all responses.
+	MinSize int
+	// ContentTypes are the compressed media types, "type/*" matches all subtypes.
+	// Nil compresses all media types.
+	ContentTypes []string
 }
 
+// NewHTTPCompressHandler returns a HTTPCompressHandler compressing
+// responses of HTTPCompressibleContentTypes from HTTPCompressMinSize bytes on.
 func NewHTTPCompressHandler(handler http.Handler) *HTTPCompressHandler {
-	return &HTTPCompressHandler{handler}
+	return &HTTPCompressHandler{
+		Handler:      handler,
+		MinSize:      HTTPCompressMinSize,
+		ContentTypes: HTTPCompressibleContentTypes,
+	}
 }
 
 func NewHTTPCompressHandlerFromFunc(handler http.HandlerFunc) *HTTPCompressHandler {
-	return &HTTPCompressHandler{handler}
+	return NewHTTPCompressHandler(handler)
 }
 
 func (h *HTTPCompressHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
-	accept := request.Header.Get("Accept-Encoding")
-	if strings.Contains(accept, "gzip") {
-		response.Header().Set("Content-Encoding", "gzip")
-		writer := Gzip.GetWriter(response)
-		defer Gzip.ReturnWriter(writer)
-		response = wrappedResponseWriter{Writer: writer, ResponseWriter: response}
-	} else if strings.Contains(accept, "deflate") {
-		response.Header().Set("Content-Encoding", "deflate")
-		writer := Deflate.GetWriter(response)
-		defer Deflate.ReturnWriter(writer)
-		response = wrappedResponseWriter{Writer: writer, ResponseWriter: response}
-	}
-	h.Handler.ServeHTTP(response, request)
+	offers := h.Encodings
+	if len(offers) == 0 {
+		offers = httpDefaultEncodings()
+	}
+	w := &httpCompressWriter{
+		ResponseWriter: response,
+		handler:        h,
+		codec:          CodecByName(HTTPNegotiateEncoding(request.Header.Get("Accept-Encoding"), offers)),
+		head:           request.Method == http.MethodHead,
+	}
+	defer w.finish()
+	h.Handler.ServeHTTP(w.wrap(), request)
+}
+
+func (h *HTTPCompressHandler) compressible(contentType string) bool {
+	if h.ContentTypes == nil {
+		return true
+	}
+	mediaType := contentType
+	if i := strings.IndexByte(mediaType, ';'); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, t := range h.ContentTypes {
+		t = strings.ToLower(t)
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpCompressWriter buffers the start of a response
+// until it is decided if it gets compressed.
+type httpCompressWriter struct {
+	http.ResponseWriter
+	handler *HTTPCompressHandler
+	codec   Codec // nil if the client accepts no codec
+	head    bool
+
+	status        int
+	buf           []byte
+	started       bool
+	headerWritten bool
+	writer        io.WriteCloser // nil if not compressed
+	hijacked      bool
+}
+
+// wrap returns w implementing the optional interfaces of the wrapped ResponseWriter.
+func (w *httpCompressWriter) wrap() http.ResponseWriter {
+	type responseWriter interface {
+		http.ResponseWriter
+		http.Flusher
+		Unwrap() http.ResponseWriter
+	}
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	_, pusher := w.ResponseWriter.(http.Pusher)
+	switch {
+	case hijacker && pusher:
+		return struct {
+			responseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, w, w}
+	case hijacker:
+		return struct {
+			responseWriter
+			http.Hijacker
+		}{w, w}
+	case pusher:
+		return struct {
+			responseWriter
+			http.Pusher
+		}{w, w}
+	}
+	return struct{ responseWriter }{w}
+}
+
+func (w *httpCompressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *httpCompressWriter) WriteHeader(status int) {
+	if w.started || w.hijacked {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if status >= 100 && status < 200 {
+		// informational responses like 103 Early Hints precede the real one
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *httpCompressWriter) Write(data []byte) (int, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !w.started {
+		w.buf = append(w.buf, data...)
+		if w.codec == nil || len(w.buf) >= w.handler.MinSize {
+			if err := w.start(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *httpCompressWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.started && w.start(true) != nil {
+		return
+	}
+	if flusher, ok := w.writer.(interface{ Flush() error }); ok {
+		if flusher.Flush() != nil {
+			return
+		}
+	}
+	w.writeHeader()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *httpCompressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *httpCompressWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// start decides if the response gets compressed, writes the header and the buffer.
+// A response is only compressed if compress is true.
+func (w *httpCompressWriter) start(compress bool) error {
+	w.started = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.Header()
+	if _, ok := header["Content-Type"]; !ok && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if w.eligible() {
+		if !StringInSlice("accept-encoding", httpHeaderTokens(header, "Vary")) {
+			header.Add("Vary", "Accept-Encoding")
+		}
+		if compress && w.codec != nil {
+			writer, err := w.codec.NewWriter(httpCompressBody{w})
+			if err == nil {
+				header.Del("Content-Length")
+				header.Set("Content-Encoding", w.codec.Name())
+				if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+					header.Set("ETag", "W/"+etag)
+				}
+				w.writer = writer
+			}
+		}
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.writer != nil {
+		_, err := w.writer.Write(buf)
+		return err
+	}
+	w.writeHeader()
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// eligible reports if the response could be compressed
+// depending on the Accept-Encoding of the request.
+func (w *httpCompressWriter) eligible() bool {
+	switch w.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	header := w.Header()
+	return !w.head &&
+		header.Get("Content-Encoding") == "" &&
+		w.handler.compressible(header.Get("Content-Type"))
+}
+
+func (w *httpCompressWriter) writeHeader() {
+	if !w.headerWritten {
+		w.headerWritten = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// finish writes a response smaller than MinSize and closes the codec.
+func (w *httpCompressWriter) finish() {
+	if w.hijacked {
+		return
+	}
+	if !w.started {
+		w.start(len(w.buf) > 0 && len(w.buf) >= w.handler.MinSize)
+	}
+	if w.writer != nil {
+		w.writer.Close()
+		w.writeHeader()
+	}
+}
+
+// httpCompressBody writes the header of the response before the compressed body.
+type httpCompressBody struct {
+	w *httpCompressWriter
+}
+
+func (b httpCompressBody) Write(data []byte) (int, error) {
+	b.w.writeHeader()
+	return b.w.ResponseWriter.Write(data)
+}
+
+// httpHeaderTokens returns the lowercased comma separated tokens
+// of all values of a header like Vary or Connection.
+func httpHeaderTokens(header http.Header, key string) []string {
+	var tokens []string
+	for _, value := range header.Values(key) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.ToLower(strings.TrimSpace(token)); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// httpDefaultEncodings returns the names of all registered codecs,
+// the default ones gzip and deflate last.
+func httpDefaultEncodings() []string {
+	var encodings, defaults []string
+	for _, codec := range Codecs() {
+		switch name := codec.Name(); strings.ToLower(name) {
+		case "gzip", "deflate":
+			defaults = append(defaults, name)
+		default:
+			encodings = append(encodings, name)
+		}
+	}
+	return append(encodings, defaults...)
+}
+
+/*
+HTTPNegotiateEncoding returns the content coding of offers with the highest
+quality value in the Accept-Encoding header acceptEncoding,
+or an empty string if the response should not be encoded.
+Offers are in order of preference, which decides between equal qualities.
+Codings not listed are acceptable with the quality of "*" if present,
+and offers with a quality of zero are never chosen.
+Example:
+
+	HTTPNegotiateEncoding("gzip;q=0.8, br", []string{"gzip", "br"}) // "br"
+	HTTPNegotiateEncoding("*;q=0.5, gzip;q=0", []string{"gzip", "br"}) // "br"
+	HTTPNegotiateEncoding("identity", []string{"gzip", "br"}) // ""
+*/
+func HTTPNegotiateEncoding(acceptEncoding string, offers []string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params := part, ""
+		if i := strings.IndexByte(part, ';'); i != -1 {
+			name, params = part[:i], part[i+1:]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, ok := qualities[strings.ToLower(offer)]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
 }
 
 // HTTPPostJSON marshalles data as JSON
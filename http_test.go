@@ -6,18 +6,23 @@
 package dry
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestHTTPCompressHandlerFunc(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		handlerFunc := HTTPCompressHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Fprintf(w, "hello world!")
+			fmt.Fprint(w, strings.Repeat("hello world!", 100))
 		})
 
 		request, err := http.NewRequest("GET", "/foobar", nil)
@@ -41,15 +46,15 @@ func TestHTTPCompressHandlerFunc(t *testing.T) {
 			t.Fatalf("Reading from body failed: %v", err)
 		}
 
-		if string(readData) != "hello world!" {
-			t.Fatalf("Body content: expected \"hello world!\", got %s instead.", string(readData))
+		if string(readData) != strings.Repeat("hello world!", 100) {
+			t.Fatalf("Body content: expected \"hello world!\" 100 times, got %s instead.", string(readData))
 		}
 	}
 }
 
 func TestHTTPCompressHandler(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		handler := &HTTPCompressHandler{&helloWorldHandler{}}
+		handler := &HTTPCompressHandler{Handler: &helloWorldHandler{}}
 
 		request, err := http.NewRequest("GET", "/foobar", nil)
 		if err != nil {
@@ -78,6 +83,214 @@ func TestHTTPCompressHandler(t *testing.T) {
 	}
 }
 
+func TestHTTPNegotiateEncoding(t *testing.T) {
+	offers := []string{"br", "gzip", "deflate"}
+	for accept, expected := range map[string]string{
+		"":                           "",
+		"identity":                   "",
+		"gzip, deflate":              "gzip",
+		"deflate, gzip":              "gzip",
+		"gzip;q=0.5, deflate":        "deflate",
+		"GZIP;Q=0.5, deflate;q=0.4":  "gzip",
+		"gzip;q=0.8, br":             "br",
+		"*":                          "br",
+		"*;q=0.5, br;q=0":            "gzip",
+		"br;q=0, gzip;q=0, *;q=0":    "",
+		"gzip;q=invalid, deflate":    "deflate",
+		" gzip ; q=1.0 , br ; q=0.9": "gzip",
+		"compress, x-unknown":        "",
+	} {
+		require.Equal(t, expected, HTTPNegotiateEncoding(accept, offers), accept)
+	}
+	require.Equal(t, "", HTTPNegotiateEncoding("gzip", nil))
+}
+
+func TestHTTPCompressHandlerCodecs(t *testing.T) {
+	registerTestCodec(t, testCodec{})
+	handler := NewHTTPCompressHandler(&helloWorldHandler{})
+	handler.MinSize = -1
+
+	serve := func(accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", accept)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve("gzip, x-test")
+	require.Equal(t, "x-test", recorder.Header().Get("Content-Encoding"))
+	reader, err := testCodec{}.NewReader(recorder.Body)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hallo welt.", string(data))
+
+	recorder = serve("gzip, x-test;q=0.5")
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "hallo welt.", string(BytesUnGzip(recorder.Body.Bytes())))
+
+	recorder = serve("deflate")
+	require.Equal(t, "deflate", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "hallo welt.", string(BytesInflate(recorder.Body.Bytes())))
+
+	recorder = serve("x-unknown")
+	require.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "hallo welt.", recorder.Body.String())
+
+	handler.Encodings = []string{"gzip", "x-test"}
+	recorder = serve("*")
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+}
+
+func TestHTTPCompressHandlerResponses(t *testing.T) {
+	large := strings.Repeat("compressible ", 200)
+	serve := func(method string, handlerFunc http.HandlerFunc) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/", nil)
+		request.Header.Set("Accept-Encoding", "gzip")
+		recorder := httptest.NewRecorder()
+		HTTPCompressHandlerFunc(handlerFunc).ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// small responses are not compressed
+	recorder := serve("GET", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		fmt.Fprint(w, "small")
+	})
+	require.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"))
+	require.Equal(t, "5", recorder.Header().Get("Content-Length"))
+	require.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "small", recorder.Body.String())
+
+	// large responses are compressed in several writes, keeping the status
+	recorder = serve("GET", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", fmt.Sprint(len(large)))
+		w.Header().Set("Vary", "Origin")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusNotFound)
+		for _, word := range strings.SplitAfter(large, " ") {
+			fmt.Fprint(w, word)
+		}
+	})
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, []string{"Origin", "Accept-Encoding"}, recorder.Header().Values("Vary"))
+	require.Equal(t, "", recorder.Header().Get("Content-Length"))
+	require.Equal(t, `W/"v1"`, recorder.Header().Get("ETag"))
+	require.Equal(t, large, string(BytesUnGzip(recorder.Body.Bytes())))
+
+	// already compressed types are not compressed
+	recorder = serve("GET", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, large)
+	})
+	require.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "", recorder.Header().Get("Vary"))
+	require.Equal(t, large, recorder.Body.String())
+
+	recorder = serve("GET", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(BytesGzip([]byte(large)))
+	})
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, large, string(BytesUnGzip(recorder.Body.Bytes())))
+
+	recorder = serve("HEAD", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, large)
+	})
+	require.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+
+	recorder = serve("GET", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	require.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, 0, recorder.Body.Len())
+
+	handler := NewHTTPCompressHandlerFromFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "png")
+	})
+	handler.ContentTypes = []string{"image/*"}
+	handler.MinSize = -1
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "png", string(BytesUnGzip(recorder.Body.Bytes())))
+
+	// literals compress responses of all sizes and types
+	recorder = httptest.NewRecorder()
+	(&HTTPCompressHandler{Handler: handler.Handler}).ServeHTTP(recorder, request)
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	require.Equal(t, "png", string(BytesUnGzip(recorder.Body.Bytes())))
+}
+
+func TestHTTPCompressHandlerInterfaces(t *testing.T) {
+	HTTPCompressHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		require.True(t, ok)
+		_, ok = w.(http.Hijacker)
+		require.False(t, ok, "httptest.ResponseRecorder is no http.Hijacker")
+		_, ok = w.(http.Pusher)
+		require.False(t, ok)
+		require.Equal(t, "*httptest.ResponseRecorder", fmt.Sprintf("%T", w.(interface{ Unwrap() http.ResponseWriter }).Unwrap()))
+	}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// server-sent events are streamed compressed
+	next := make(chan struct{})
+	server := httptest.NewServer(HTTPCompressHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	}))
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.True(t, response.Uncompressed, "transparently decompressed gzip")
+	require.Equal(t, "Accept-Encoding", response.Header.Get("Vary"))
+	reader := bufio.NewReader(response.Body)
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("data: %d\n", i), line)
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		next <- struct{}{}
+	}
+
+	// hijacking works for websockets
+	hijackServer := httptest.NewServer(HTTPCompressHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	}))
+	defer hijackServer.Close()
+	conn, err := net.Dial("tcp", hijackServer.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\nAccept-Encoding: gzip\r\n\r\n")
+	hijackResponse, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(hijackResponse.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hijacked", string(body))
+	require.Equal(t, "", hijackResponse.Header.Get("Content-Encoding"))
+}
+
 type helloWorldHandler null
 
 func (h *helloWorldHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
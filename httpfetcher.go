@@ -0,0 +1,393 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPStatusError is returned if a server responds with an unexpected status code.
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// FileHTTP is the fetcher behind the http:// and https:// schemes of FileGet* helpers.
+// Its fields can be changed to enable retries or caching, but only before it is used.
+var FileHTTP = &HTTPFetcher{}
+
+// HTTPFetcher downloads HTTP resources with optional retries,
+// conditional requests against an on-disk cache and resumable downloads.
+// The zero value is usable and behaves like a plain http.Get.
+type HTTPFetcher struct {
+	// Client is used for all requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Retries is the number of additional attempts after network errors
+	// and 5xx responses.
+	Retries int
+	// MinBackoff is the wait time before the first retry, doubled for
+	// every further one. Defaults to 100ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait time between retries. Defaults to 10s.
+	MaxBackoff time.Duration
+	// CacheDir enables caching of responses with ETag or Last-Modified headers.
+	// Cached resources are revalidated with If-None-Match and If-Modified-Since.
+	CacheDir string
+}
+
+// httpCacheMeta holds the validators of a cached or partially downloaded resource.
+type httpCacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func httpReadMeta(path string) (*httpCacheMeta, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := new(httpCacheMeta)
+	return meta, json.Unmarshal(data, meta)
+}
+
+func (m *httpCacheMeta) valid() bool {
+	return m.ETag != "" || m.LastModified != ""
+}
+
+func (m *httpCacheMeta) update(header http.Header) {
+	m.ETag = header.Get("ETag")
+	m.LastModified = header.Get("Last-Modified")
+}
+
+func (f *HTTPFetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+// backoff returns the wait time before retry number attempt (starting at 0).
+func (f *HTTPFetcher) backoff(attempt int) time.Duration {
+	min, max := f.MinBackoff, f.MaxBackoff
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	wait := min
+	for i := 0; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+func (f *HTTPFetcher) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// wait sleeps before retry number attempt, or returns false
+// if there are no retries left or ctx is done.
+func (f *HTTPFetcher) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt >= f.Retries || !f.retryable(ctx, err) {
+		return false
+	}
+	timer := time.NewTimer(f.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// do sends the request built by newRequest until it gets a response
+// with a status code below 500 or runs out of retries.
+func (f *HTTPFetcher) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		request, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		response, err := f.client().Do(request.WithContext(ctx))
+		if err == nil && response.StatusCode >= 500 {
+			response.Body.Close()
+			err = &HTTPStatusError{StatusCode: response.StatusCode}
+		}
+		if err == nil {
+			return response, nil
+		}
+		if !f.wait(ctx, attempt, err) {
+			return nil, err
+		}
+	}
+}
+
+// Open implements FileContextOpenerFunc. Retries cover the request
+// until the response headers arrive, not reading the body.
+func (f *HTTPFetcher) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	cached := f.cachedMeta(url)
+	response, err := f.do(ctx, func() (*http.Request, error) {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err == nil && cached != nil {
+			if cached.ETag != "" {
+				request.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				request.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+		return request, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		response.Body.Close()
+		return os.Open(f.cachePath(url) + ".body")
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		response.Body.Close()
+		return nil, &HTTPStatusError{StatusCode: response.StatusCode}
+	}
+
+	meta := httpCacheMeta{URL: url}
+	meta.update(response.Header)
+	if f.CacheDir == "" || !meta.valid() {
+		return response.Body, nil
+	}
+	return f.cacheBody(url, meta, response.Body)
+}
+
+// Get reads the resource at url completely.
+func (f *HTTPFetcher) Get(ctx context.Context, url string) ([]byte, error) {
+	reader, err := f.Open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return fileReadAllContext(ctx, reader, 0)
+}
+
+func (f *HTTPFetcher) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(f.CacheDir, hex.EncodeToString(sum[:]))
+}
+
+// cachedMeta returns the validators of the cached url, or nil if there is none.
+func (f *HTTPFetcher) cachedMeta(url string) *httpCacheMeta {
+	if f.CacheDir == "" {
+		return nil
+	}
+	path := f.cachePath(url)
+	meta, err := httpReadMeta(path + ".json")
+	if err != nil || meta.URL != url || !meta.valid() {
+		return nil
+	}
+	if !FileExists(path + ".body") {
+		return nil
+	}
+	return meta
+}
+
+func (f *HTTPFetcher) cacheBody(url string, meta httpCacheMeta, body io.ReadCloser) (io.ReadCloser, error) {
+	if err := os.MkdirAll(f.CacheDir, 0700); err != nil {
+		body.Close()
+		return nil, err
+	}
+	path := f.cachePath(url)
+	// stale validators must not survive a half written body
+	if err := os.Remove(path + ".json"); err != nil && !os.IsNotExist(err) {
+		body.Close()
+		return nil, err
+	}
+	writer, err := NewAtomicFileWriter(path+".body", FileWriteOptions{Perm: 0600})
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &httpCachingBody{body: body, writer: writer, metaPath: path + ".json", meta: meta}, nil
+}
+
+// httpCachingBody copies everything read from body into the cache
+// and commits it when body was read completely.
+type httpCachingBody struct {
+	body     io.ReadCloser
+	writer   *AtomicFileWriter
+	metaPath string
+	meta     httpCacheMeta
+}
+
+func (b *httpCachingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.writer != nil && n > 0 {
+		if _, werr := b.writer.Write(p[:n]); werr != nil {
+			// caching is best effort, the caller still gets the data
+			b.writer.Abort()
+			b.writer = nil
+		}
+	}
+	if err == io.EOF && b.writer != nil {
+		if b.writer.Close() == nil {
+			FileSetJSON(b.metaPath, b.meta, FileWriteOptions{Atomic: true, Perm: 0600})
+		}
+		b.writer = nil
+	}
+	return n, err
+}
+
+func (b *httpCachingBody) Close() error {
+	if b.writer != nil {
+		b.writer.Abort()
+		b.writer = nil
+	}
+	return b.body.Close()
+}
+
+// Download stores the resource at url in filename.
+// Data is written to filename+".part" first, if a download gets
+// interrupted, the next call (or retry) continues it with a Range request,
+// as long as the resource didn't change in the meantime.
+func (f *HTTPFetcher) Download(ctx context.Context, url, filename string) error {
+	part := filename + ".part"
+	metaPath := part + ".json"
+
+	meta, err := httpReadMeta(metaPath)
+	if err != nil || meta.URL != url {
+		meta = &httpCacheMeta{URL: url}
+		if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := f.downloadPart(ctx, url, part, metaPath, meta)
+		if err == nil {
+			break
+		}
+		if !f.wait(ctx, attempt, err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(part, filename); err != nil {
+		return err
+	}
+	os.Remove(metaPath)
+	return fileSyncDir(filepath.Dir(filename))
+}
+
+// downloadPart requests the missing rest of part and appends it.
+func (f *HTTPFetcher) downloadPart(ctx context.Context, url, part, metaPath string, meta *httpCacheMeta) error {
+	offset := FileSize(part)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && meta.valid() {
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		if meta.ETag != "" {
+			request.Header.Set("If-Range", meta.ETag)
+		} else {
+			request.Header.Set("If-Range", meta.LastModified)
+		}
+	} else {
+		offset = 0
+	}
+
+	response, err := f.client().Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		start, _, err := httpParseContentRange(response.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			os.Remove(part)
+			return fmt.Errorf("unexpected Content-Range '%s'", response.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		meta.update(response.Header)
+		if err := FileSetJSON(metaPath, meta, FileAtomic); err != nil {
+			return err
+		}
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		_, total, err := httpParseContentRange(response.Header.Get("Content-Range"))
+		if err == nil && total == offset {
+			return nil
+		}
+		os.Remove(part)
+		return &HTTPStatusError{StatusCode: response.StatusCode}
+	default:
+		return &HTTPStatusError{StatusCode: response.StatusCode}
+	}
+
+	file, err := os.OpenFile(part, flags, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, response.Body)
+	if err == nil {
+		err = file.Sync()
+	}
+	return FirstError(err, file.Close())
+}
+
+// httpParseContentRange parses "bytes start-end/total" and "bytes */total".
+// total is -1 if it is unknown.
+func httpParseContentRange(contentRange string) (start, total int64, err error) {
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	rangePart, totalPart := StringSplitOnceChar(spec, '/')
+	if spec == contentRange || totalPart == "" {
+		return 0, 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if rangePart == "*" {
+		return 0, total, nil
+	}
+	startPart, _ := StringSplitOnceChar(rangePart, '-')
+	start, err = strconv.ParseInt(startPart, 10, 64)
+	return start, total, err
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HTTPFetcherRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case atomic.AddInt32(&requests, 1) <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	fetcher := &HTTPFetcher{Retries: 3, MinBackoff: time.Millisecond}
+	data, err := fetcher.Get(context.Background(), server.URL)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	_, err = fetcher.Get(context.Background(), server.URL+"/missing")
+	var statusErr *HTTPStatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+
+	atomic.StoreInt32(&requests, 0)
+	_, err = (&HTTPFetcher{}).Get(context.Background(), server.URL)
+	require.EqualError(t, err, "503: Service Unavailable")
+}
+
+func Test_HTTPFetcherCache(t *testing.T) {
+	var full, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+		} else {
+			atomic.AddInt32(&full, 1)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte("cached content")))
+	}))
+	defer server.Close()
+
+	fetcher := &HTTPFetcher{CacheDir: filepath.Join(t.TempDir(), "cache")}
+	for i := 0; i < 3; i++ {
+		data, err := fetcher.Get(context.Background(), server.URL)
+		require.NoError(t, err)
+		require.Equal(t, "cached content", string(data))
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&full))
+	require.Equal(t, int32(2), atomic.LoadInt32(&notModified))
+}
+
+func Test_HTTPFetcherDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var requests int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "download.bin")
+	fetcher := &HTTPFetcher{Retries: 2, MinBackoff: time.Millisecond}
+	require.NoError(t, fetcher.Download(context.Background(), server.URL, filename))
+
+	data, err := FileGetBytes(filename)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, []string{"bytes=" + strconv.Itoa(len(content)/2) + "-"}, ranges)
+	require.False(t, FileExists(filename+".part"))
+	require.False(t, FileExists(filename+".part.json"))
+}
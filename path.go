@@ -6,7 +6,10 @@
 package dry
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -40,24 +43,358 @@ func PathSplitExt(path string) (basepath, ext string) {
 	return
 }
 
+// PathIsWritable reports if path, or its nearest existing parent directory,
+// is writable. See PathInspect for more details.
 func PathIsWritable(path string) bool {
 	return pathIsWritable(path)
 }
 
+// PathNearestExisting returns path if it exists, or its nearest existing
+// parent directory, or an empty string if there is none.
 func PathNearestExisting(path string) string {
-	if FileExists(path) {
-		return path
+	for {
+		if FileExists(path) {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ""
+		}
+		path = parent
+	}
+}
+
+// PathInfo is returned by PathInspect.
+type PathInfo struct {
+	// Path is the absolute inspected path.
+	Path string
+	// Nearest is Path if it exists, or its nearest existing parent directory.
+	Nearest string
+	Exists  bool
+	IsDir   bool
+
+	// Mode, access and owner are only set if Path exists.
+	// Readable, Writable and Executable are the permissions
+	// of the current process, which for directories mean
+	// listing, creating entries and accessing entries.
+	Mode       os.FileMode
+	Readable   bool
+	Writable   bool
+	Executable bool
+	// UID and GID are -1 if unknown, e.g. on Windows.
+	UID, GID int
+	// Owner and Group are names, or empty if unknown.
+	Owner, Group string
+
+	// Creatable reports if Path doesn't exist and could be created
+	// by the current process, including all missing parent directories.
+	Creatable bool
+
+	// FSType is the name of the filesystem of Nearest,
+	// like "ext2/3/4", "tmpfs", "nfs" or "NTFS", or empty if unknown.
+	FSType string
+	// FreeBytes is the space available to the current process,
+	// TotalBytes the size of the filesystem. Both are 0 if unknown.
+	FreeBytes  uint64
+	TotalBytes uint64
+}
+
+// PathInspect reports permissions, owner and filesystem details of path
+// for preflight checks, e.g. before starting a job that writes to path.
+// path doesn't have to exist, in that case PathInfo.Creatable tells
+// if it could be created.
+// Example:
+//
+//	info, err := PathInspect(outputDir)
+//	if err != nil {
+//		return err
+//	}
+//	if !info.Writable && !info.Creatable {
+//		return fmt.Errorf("can't write to '%s'", outputDir)
+//	}
+//	if info.FreeBytes < expectedSize {
+//		return fmt.Errorf("only %d bytes free on %s filesystem", info.FreeBytes, info.FSType)
+//	}
+func PathInspect(path string) (*PathInfo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &PathInfo{Path: abs, UID: -1, GID: -1}
+	info.Nearest = PathNearestExisting(abs)
+	if info.Nearest == "" {
+		return nil, fmt.Errorf("no existing parent directory of '%s'", path)
+	}
+	stat, err := os.Stat(info.Nearest)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nearest == abs {
+		info.Exists = true
+		info.IsDir = stat.IsDir()
+		info.Mode = stat.Mode()
+	}
+	if err = pathInspect(info, stat); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ErrPathEscapes is returned by PathSecureJoin for
+// untrusted paths that would lead outside of the root directory.
+var ErrPathEscapes = errors.New("path escapes root directory")
+
+// pathMaxSymlinks limits the symlinks followed by PathSecureJoin like the kernel does.
+const pathMaxSymlinks = 255
+
+/*
+PathSecureJoin joins the trusted directory root with the untrusted
+relative path unsafePath, which can be slash or OS separated.
+It returns an error wrapping ErrPathEscapes if unsafePath is absolute,
+if ".." components would leave root, or if a symlink below root
+resolves to a location outside of it.
+Symlinks inside root are resolved, so the result doesn't contain any.
+Components that don't exist yet are joined as they are, so the result
+can be used to create new files.
+Example:
+
+	filename, err := PathSecureJoin("/srv/uploads", request.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+The check can't protect against somebody changing the directory tree
+between the call and the use of its result.
+*/
+func PathSecureJoin(root, unsafePath string) (string, error) {
+	if strings.IndexByte(unsafePath, 0) != -1 {
+		return "", fmt.Errorf("invalid path '%s': contains NUL", unsafePath)
+	}
+	unsafePath = filepath.FromSlash(unsafePath)
+	if filepath.IsAbs(unsafePath) || filepath.VolumeName(unsafePath) != "" ||
+		strings.HasPrefix(unsafePath, string(filepath.Separator)) {
+		return "", fmt.Errorf("absolute path '%s': %w", unsafePath, ErrPathEscapes)
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
 	}
+	// symlink targets are compared with the resolved root as well,
+	// in case root itself is below a symlink
+	rootReal, err := filepath.EvalSymlinks(rootAbs)
+	if err != nil {
+		rootReal = rootAbs
+	}
+
+	var resolved []string
+	pending := pathComponents(unsafePath)
+	links := 0
+	for len(pending) > 0 {
+		component := pending[0]
+		pending = pending[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", fmt.Errorf("path '%s': %w", unsafePath, ErrPathEscapes)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
 
-	testpath := path
-	for testpath != "" {
-		testpath, _ = filepath.Split(testpath)
-		testpath = testpath[:len(testpath)-1] // removing trailing /
-		if FileExists(testpath) {
-			return testpath
+		current := filepath.Join(rootAbs, filepath.Join(resolved...), component)
+		info, err := os.Lstat(current)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			// nothing below a missing directory can be a symlink
+			resolved = append(resolved, component)
+			continue
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = append(resolved, component)
+			continue
+		}
+
+		if links++; links > pathMaxSymlinks {
+			return "", fmt.Errorf("path '%s': too many levels of symbolic links", unsafePath)
+		}
+		target, err := os.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+			rel, ok := pathRelInside(rootAbs, target)
+			if !ok {
+				rel, ok = pathRelInside(rootReal, target)
+			}
+			if !ok {
+				return "", fmt.Errorf("symlink '%s' to '%s': %w", current, target, ErrPathEscapes)
+			}
+			resolved = nil
+			target = rel
 		}
-		fmt.Println(testpath)
+		pending = append(pathComponents(target), pending...)
+	}
+	return filepath.Join(root, filepath.Join(resolved...)), nil
+}
+
+func pathComponents(path string) []string {
+	return strings.Split(path, string(filepath.Separator))
+}
+
+// pathRelInside returns target relative to root,
+// if target is root or inside of it.
+func pathRelInside(root, target string) (string, bool) {
+	rel, err := filepath.Rel(root, filepath.Clean(target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+/*
+RootedFS confines file access to a root directory.
+All names are untrusted relative paths passed through PathSecureJoin,
+so user supplied names can be used safely.
+Example:
+
+	uploads := NewRootedFS("/srv/uploads")
+	data, err := uploads.GetBytes(request.URL.Query().Get("file"))
+*/
+type RootedFS struct {
+	root string
+}
+
+// NewRootedFS returns a RootedFS for the directory root.
+func NewRootedFS(root string) *RootedFS {
+	return &RootedFS{root: root}
+}
+
+// Root returns the root directory.
+func (r *RootedFS) Root() string {
+	return r.root
+}
+
+// Path returns the filename of name inside the root directory, see PathSecureJoin.
+func (r *RootedFS) Path(name string) (string, error) {
+	return PathSecureJoin(r.root, name)
+}
+
+func (r *RootedFS) Open(name string) (*os.File, error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (r *RootedFS) Create(name string) (*os.File, error) {
+	return r.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0660)
+}
+
+func (r *RootedFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	filename, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filename, flag, perm)
+}
+
+func (r *RootedFS) Stat(name string) (os.FileInfo, error) {
+	filename, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(filename)
+}
+
+func (r *RootedFS) Exists(name string) bool {
+	_, err := r.Stat(name)
+	return err == nil
+}
+
+func (r *RootedFS) ReadDir(name string) ([]os.FileInfo, error) {
+	filename, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadDir(filename)
+}
+
+func (r *RootedFS) GetBytes(name string) ([]byte, error) {
+	filename, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filename)
+}
+
+func (r *RootedFS) GetString(name string) (string, error) {
+	data, err := r.GetBytes(name)
+	return string(data), err
+}
+
+// SetBytes writes data to name, see FileSetBytes.
+func (r *RootedFS) SetBytes(name string, data []byte, options ...FileWriteOptions) error {
+	filename, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return FileSetBytes(filename, data, options...)
+}
+
+func (r *RootedFS) SetString(name string, data string, options ...FileWriteOptions) error {
+	return r.SetBytes(name, []byte(data), options...)
+}
+
+func (r *RootedFS) AppendBytes(name string, data []byte) error {
+	filename, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return FileAppendBytes(filename, data)
+}
+
+func (r *RootedFS) MkdirAll(name string, perm os.FileMode) error {
+	filename, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(filename, perm)
+}
+
+// pathNoFollow is like Path, but doesn't resolve
+// a symlink in the last component of name.
+func (r *RootedFS) pathNoFollow(name string) (string, error) {
+	dir, base := filepath.Split(filepath.FromSlash(name))
+	if base == "" || base == "." || base == ".." {
+		return r.Path(name)
+	}
+	parent, err := r.Path(dir)
+	if err != nil {
+		return "", err
 	}
+	return filepath.Join(parent, base), nil
+}
 
-	return ""
+// Remove removes the file, symlink or empty directory name.
+func (r *RootedFS) Remove(name string) error {
+	filename, err := r.pathNoFollow(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// Rename moves oldName to newName, symlinks are moved themselves.
+func (r *RootedFS) Rename(oldName, newName string) error {
+	oldFilename, err := r.pathNoFollow(oldName)
+	if err != nil {
+		return err
+	}
+	newFilename, err := r.pathNoFollow(newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldFilename, newFilename)
 }
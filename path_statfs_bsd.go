@@ -0,0 +1,26 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build darwin freebsd
+
+package dry
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+func pathStatfs(path string) (fsType string, free, total uint64, err error) {
+	var st unix.Statfs_t
+	if err = unix.Statfs(path, &st); err != nil {
+		return "", 0, 0, err
+	}
+	name := st.Fstypename[:]
+	if i := bytes.IndexByte(name, 0); i != -1 {
+		name = name[:i]
+	}
+	return string(name), uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
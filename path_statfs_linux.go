@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build linux
+
+package dry
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// pathFSTypes maps the magic numbers of statfs to filesystem names.
+var pathFSTypes = map[int64]string{
+	unix.EXT4_SUPER_MAGIC:      "ext2/3/4",
+	unix.XFS_SUPER_MAGIC:       "xfs",
+	unix.BTRFS_SUPER_MAGIC:     "btrfs",
+	0x2fc12fc1:                 "zfs",
+	unix.F2FS_SUPER_MAGIC:      "f2fs",
+	unix.REISERFS_SUPER_MAGIC:  "reiserfs",
+	unix.TMPFS_MAGIC:           "tmpfs",
+	unix.RAMFS_MAGIC:           "ramfs",
+	unix.OVERLAYFS_SUPER_MAGIC: "overlay",
+	unix.SQUASHFS_MAGIC:        "squashfs",
+	unix.ISOFS_SUPER_MAGIC:     "iso9660",
+	unix.UDF_SUPER_MAGIC:       "udf",
+	unix.MSDOS_SUPER_MAGIC:     "vfat",
+	0x2011bab0:                 "exfat",
+	0x5346544e:                 "ntfs",
+	0x65735546:                 "fuse",
+	unix.NFS_SUPER_MAGIC:       "nfs",
+	unix.SMB_SUPER_MAGIC:       "smb",
+	0xff534d42:                 "cifs",
+	0xfe534d42:                 "smb2",
+	unix.V9FS_MAGIC:            "9p",
+	unix.PROC_SUPER_MAGIC:      "proc",
+	unix.SYSFS_MAGIC:           "sysfs",
+	unix.DEVPTS_SUPER_MAGIC:    "devpts",
+	unix.CGROUP2_SUPER_MAGIC:   "cgroup2",
+}
+
+func pathStatfs(path string) (fsType string, free, total uint64, err error) {
+	var st unix.Statfs_t
+	if err = unix.Statfs(path, &st); err != nil {
+		return "", 0, 0, err
+	}
+	fsType, ok := pathFSTypes[int64(st.Type)]
+	if !ok {
+		fsType = fmt.Sprintf("0x%x", uint64(st.Type))
+	}
+	return fsType, uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+// +build !linux,!darwin,!freebsd,!windows
+
+package dry
+
+import "errors"
+
+// pathStatfs is only implemented for Linux, macOS and FreeBSD.
+func pathStatfs(path string) (fsType string, free, total uint64, err error) {
+	return "", 0, 0, errors.New("statfs not supported")
+}
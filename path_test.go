@@ -0,0 +1,133 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathSecureJoin(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	outside := t.TempDir()
+
+	for unsafePath, expected := range map[string]string{
+		"file.txt":         "file.txt",
+		"a/b/file.txt":     "a/b/file.txt",
+		"a/../file.txt":    "file.txt",
+		"./a//b/":          "a/b",
+		"":                 "",
+		"missing/../x.txt": "x.txt",
+	} {
+		joined, err := PathSecureJoin(root, unsafePath)
+		require.NoError(t, err, unsafePath)
+		require.Equal(t, filepath.Join(root, filepath.FromSlash(expected)), joined, unsafePath)
+	}
+
+	for _, unsafePath := range []string{"..", "../x", "a/../../x", "/etc/passwd", "a/b/../../.."} {
+		_, err := PathSecureJoin(root, unsafePath)
+		require.True(t, errors.Is(err, ErrPathEscapes), "%s: %v", unsafePath, err)
+	}
+	_, err := PathSecureJoin(root, "a\x00b")
+	require.Error(t, err)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	require.NoError(t, os.Symlink("a/b", filepath.Join(root, "inside")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "absinside")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "abs")))
+	require.NoError(t, os.Symlink("../..", filepath.Join(root, "a", "up")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(root, "loop")))
+
+	joined, err := PathSecureJoin(root, "inside/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "a", "b", "file.txt"), joined)
+	joined, err = PathSecureJoin(root, "absinside/b")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "a", "b"), joined)
+
+	for _, unsafePath := range []string{"abs/file.txt", "a/up/x", "inside/../../.."} {
+		_, err := PathSecureJoin(root, unsafePath)
+		require.True(t, errors.Is(err, ErrPathEscapes), "%s: %v", unsafePath, err)
+	}
+	_, err = PathSecureJoin(root, "loop")
+	require.Error(t, err)
+}
+
+func TestRootedFS(t *testing.T) {
+	root := t.TempDir()
+	fs := NewRootedFS(root)
+	require.NoError(t, fs.MkdirAll("dir", 0755))
+	require.NoError(t, fs.SetString("dir/file.txt", "data"))
+	require.True(t, fs.Exists("dir/file.txt"))
+	data, err := fs.GetString("dir/../dir/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, "data", data)
+
+	require.NoError(t, fs.Rename("dir/file.txt", "moved.txt"))
+	infos, err := fs.ReadDir(".")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	_, err = fs.Open("../etc/passwd")
+	require.True(t, errors.Is(err, ErrPathEscapes))
+	require.True(t, errors.Is(fs.SetString("/tmp/x", "x"), ErrPathEscapes))
+
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Symlink("moved.txt", filepath.Join(root, "link")))
+		require.NoError(t, fs.Remove("link"))
+		require.True(t, fs.Exists("moved.txt"))
+	}
+	require.NoError(t, fs.Remove("moved.txt"))
+	require.False(t, fs.Exists("moved.txt"))
+}
+
+func TestPathNearestExisting(t *testing.T) {
+	dir := t.TempDir()
+	require.Equal(t, dir, PathNearestExisting(dir))
+	require.Equal(t, dir, PathNearestExisting(filepath.Join(dir, "a", "b")))
+	require.Equal(t, ".", PathNearestExisting(filepath.Join("missing-dir", "file")))
+}
+
+func TestPathInspect(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file.txt")
+	require.NoError(t, FileSetString(filename, "data"))
+	require.NoError(t, os.Chmod(filename, 0640))
+
+	info, err := PathInspect(filename)
+	require.NoError(t, err)
+	require.True(t, info.Exists)
+	require.False(t, info.IsDir)
+	require.True(t, info.Readable)
+	require.False(t, info.Creatable)
+	require.NotEmpty(t, info.FSType)
+	require.NotZero(t, info.TotalBytes)
+	if runtime.GOOS != "windows" {
+		require.Equal(t, os.FileMode(0640), info.Mode.Perm())
+		require.False(t, info.Executable)
+		require.Equal(t, os.Getuid(), info.UID)
+	}
+
+	info, err = PathInspect(filepath.Join(dir, "new", "sub"))
+	require.NoError(t, err)
+	require.False(t, info.Exists)
+	require.Equal(t, dir, info.Nearest)
+	require.True(t, info.Creatable)
+	require.False(t, info.Writable)
+
+	// a file can't be a parent directory
+	info, err = PathInspect(filepath.Join(filename, "sub"))
+	require.NoError(t, err)
+	require.False(t, info.Creatable)
+}
@@ -8,7 +8,12 @@
 package dry
 
 import (
+	"fmt"
+	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"syscall"
 
 	"golang.org/x/sys/unix"
 )
@@ -23,3 +28,74 @@ func pathIsWritable(path string) bool {
 
 	return unix.Access(nearestPath, unix.W_OK) == nil
 }
+
+// pathInspect fills the system dependent fields of info.
+// stat is the info of info.Nearest.
+func pathInspect(info *PathInfo, stat os.FileInfo) error {
+	if info.Exists {
+		info.Readable = unix.Access(info.Path, unix.R_OK) == nil
+		info.Writable = unix.Access(info.Path, unix.W_OK) == nil
+		info.Executable = unix.Access(info.Path, unix.X_OK) == nil
+		if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+			info.UID, info.GID = int(sys.Uid), int(sys.Gid)
+			if u, err := user.LookupId(strconv.Itoa(info.UID)); err == nil {
+				info.Owner = u.Username
+			}
+			if g, err := user.LookupGroupId(strconv.Itoa(info.GID)); err == nil {
+				info.Group = g.Name
+			}
+		}
+	} else {
+		info.Creatable = stat.IsDir() && unix.Access(info.Nearest, unix.W_OK|unix.X_OK) == nil
+	}
+
+	// unknown filesystem details are no error
+	info.FSType, info.FreeBytes, info.TotalBytes, _ = pathStatfs(info.Nearest)
+	return nil
+}
+
+// pathUserDir returns the XDG default of kind.
+func pathUserDir(kind PathDirKind) (string, error) {
+	if kind == PathRuntimeDir {
+		// the specification wants a replacement directory with the same guarantees,
+		// which is as close as possible without a session manager
+		dir := filepath.Join(os.TempDir(), "runtime-"+strconv.Itoa(os.Getuid()))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+		// another user could have created it first, Lstat rejects symlinks
+		info, err := os.Lstat(dir)
+		if err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+			return "", fmt.Errorf("unsafe runtime directory '%s'", dir)
+		}
+		if sys, ok := info.Sys().(*syscall.Stat_t); !ok || int(sys.Uid) != os.Getuid() {
+			return "", fmt.Errorf("unsafe runtime directory '%s' not owned by the user", dir)
+		}
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case PathConfigDir:
+		return filepath.Join(home, ".config"), nil
+	case PathCacheDir:
+		return filepath.Join(home, ".cache"), nil
+	case PathDataDir:
+		return filepath.Join(home, ".local", "share"), nil
+	default:
+		return filepath.Join(home, ".local", "state"), nil
+	}
+}
+
+func pathSystemDirs(kind PathDirKind) []string {
+	if kind == PathConfigDir {
+		return []string{"/etc/xdg"}
+	}
+	return []string{"/usr/local/share", "/usr/share"}
+}
+
+func pathAppJoin(kind PathDirKind, dir, app string) string {
+	return filepath.Join(dir, app)
+}
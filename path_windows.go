@@ -7,6 +7,15 @@
 
 package dry
 
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
 func pathIsWritable(path string) bool {
 	// currently it's too hard to implement windows checking (i really want to! but i don't have any windows
 	// machine to test). We found this package github.com/hectane/go-acl, so we can implement this feature
@@ -14,3 +23,91 @@ func pathIsWritable(path string) bool {
 	// TODO: implement it
 	return true
 }
+
+// pathInspect fills the system dependent fields of info.
+// ACLs are not evaluated, so Writable only reflects
+// the read-only attribute, and owners are unknown.
+func pathInspect(info *PathInfo, stat os.FileInfo) error {
+	if info.Exists {
+		if file, err := os.Open(info.Path); err == nil {
+			file.Close()
+			info.Readable = true
+		}
+		info.Writable = stat.Mode()&0200 != 0
+		info.Executable = info.IsDir || pathIsExecutableExt(filepath.Ext(info.Path))
+	} else {
+		info.Creatable = stat.IsDir()
+	}
+
+	// unknown volume details are no error
+	info.FSType, info.FreeBytes, info.TotalBytes, _ = pathVolumeInfo(info.Nearest)
+	return nil
+}
+
+// pathIsExecutableExt checks ext against the PATHEXT environment variable.
+func pathIsExecutableExt(ext string) bool {
+	pathExt := os.Getenv("PATHEXT")
+	if pathExt == "" {
+		pathExt = ".COM;.EXE;.BAT;.CMD"
+	}
+	for _, e := range strings.Split(pathExt, ";") {
+		if e != "" && strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathVolumeInfo(path string) (fsType string, free, total uint64, err error) {
+	path16, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	volume := make([]uint16, windows.MAX_PATH+1)
+	if err = windows.GetVolumePathName(path16, &volume[0], uint32(len(volume))); err != nil {
+		return "", 0, 0, err
+	}
+	if err = windows.GetDiskFreeSpaceEx(&volume[0], &free, &total, nil); err != nil {
+		return "", 0, 0, err
+	}
+	name := make([]uint16, windows.MAX_PATH+1)
+	if err = windows.GetVolumeInformation(&volume[0], nil, 0, nil, nil, nil, &name[0], uint32(len(name))); err != nil {
+		return "", free, total, err
+	}
+	return windows.UTF16ToString(name), free, total, nil
+}
+
+// pathUserDir returns the Windows default of kind.
+func pathUserDir(kind PathDirKind) (string, error) {
+	env := "LOCALAPPDATA"
+	switch kind {
+	case PathConfigDir:
+		env = "APPDATA"
+	case PathRuntimeDir:
+		return os.TempDir(), nil
+	}
+	dir := os.Getenv(env)
+	if dir == "" {
+		return "", errors.New("%" + env + "% is not defined")
+	}
+	return dir, nil
+}
+
+func pathSystemDirs(kind PathDirKind) []string {
+	if dir := os.Getenv("PROGRAMDATA"); dir != "" {
+		return []string{dir}
+	}
+	return nil
+}
+
+// pathAppJoin separates cache and state inside the application directory,
+// because they share %LOCALAPPDATA% with data.
+func pathAppJoin(kind PathDirKind, dir, app string) string {
+	switch kind {
+	case PathCacheDir:
+		return filepath.Join(dir, app, "Cache")
+	case PathStateDir:
+		return filepath.Join(dir, app, "State")
+	}
+	return filepath.Join(dir, app)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PathDirKind is a kind of standard directory, see PathUserDir.
+type PathDirKind int
+
+const (
+	PathConfigDir PathDirKind = iota
+	PathCacheDir
+	PathDataDir
+	PathStateDir
+	// PathRuntimeDir is for sockets, pipes and lock files
+	// that don't survive a reboot.
+	PathRuntimeDir
+)
+
+func (kind PathDirKind) String() string {
+	switch kind {
+	case PathConfigDir:
+		return "config"
+	case PathCacheDir:
+		return "cache"
+	case PathDataDir:
+		return "data"
+	case PathStateDir:
+		return "state"
+	case PathRuntimeDir:
+		return "runtime"
+	}
+	return fmt.Sprintf("PathDirKind(%d)", int(kind))
+}
+
+// pathDirEnv are the environment variables overriding the user directories.
+var pathDirEnv = map[PathDirKind]string{
+	PathConfigDir:  "XDG_CONFIG_HOME",
+	PathCacheDir:   "XDG_CACHE_HOME",
+	PathDataDir:    "XDG_DATA_HOME",
+	PathStateDir:   "XDG_STATE_HOME",
+	PathRuntimeDir: "XDG_RUNTIME_DIR",
+}
+
+// pathSearchDirsEnv are the environment variables listing
+// system directories searched after the user directory.
+var pathSearchDirsEnv = map[PathDirKind]string{
+	PathConfigDir: "XDG_CONFIG_DIRS",
+	PathDataDir:   "XDG_DATA_DIRS",
+}
+
+/*
+PathUserDir returns the base directory of kind for the current user.
+On Windows the defaults are %APPDATA% for config,
+%LOCALAPPDATA% for cache, data and state, and the temp directory
+for runtime files. Elsewhere the XDG base directory specification is used:
+
+	config   $XDG_CONFIG_HOME or ~/.config
+	cache    $XDG_CACHE_HOME  or ~/.cache
+	data     $XDG_DATA_HOME   or ~/.local/share
+	state    $XDG_STATE_HOME  or ~/.local/state
+	runtime  $XDG_RUNTIME_DIR or a per user directory in the temp directory
+
+The XDG environment variables override the defaults on all systems,
+relative paths in them are ignored as the specification demands.
+*/
+func PathUserDir(kind PathDirKind) (string, error) {
+	env, ok := pathDirEnv[kind]
+	if !ok {
+		return "", fmt.Errorf("invalid %s", kind)
+	}
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	return pathUserDir(kind)
+}
+
+// PathAppDir returns the directory of kind for the application app,
+// see PathUserDir. The directory is not created.
+func PathAppDir(kind PathDirKind, app string) (string, error) {
+	dir, err := PathUserDir(kind)
+	if err != nil {
+		return "", err
+	}
+	return pathAppJoin(kind, dir, app), nil
+}
+
+// PathAppDirCreate returns the directory of kind for the application app,
+// and creates it only accessible by the current user if it doesn't exist.
+func PathAppDirCreate(kind PathDirKind, app string) (string, error) {
+	dir, err := PathAppDir(kind, app)
+	if err != nil {
+		return "", err
+	}
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// PathSearchDirs returns the user directory of kind followed by the
+// system directories in order of preference.
+// For config these are $XDG_CONFIG_DIRS or /etc/xdg,
+// for data $XDG_DATA_DIRS or /usr/local/share and /usr/share,
+// and %PROGRAMDATA% for both on Windows.
+// Other kinds only have the user directory.
+func PathSearchDirs(kind PathDirKind) []string {
+	var dirs []string
+	if dir, err := PathUserDir(kind); err == nil {
+		dirs = append(dirs, dir)
+	}
+	env, ok := pathSearchDirsEnv[kind]
+	if !ok {
+		return dirs
+	}
+	var systemDirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(env)) {
+		if filepath.IsAbs(dir) {
+			systemDirs = append(systemDirs, dir)
+		}
+	}
+	if len(systemDirs) == 0 {
+		systemDirs = pathSystemDirs(kind)
+	}
+	return append(dirs, systemDirs...)
+}
+
+// PathAppSearchDirs returns PathSearchDirs joined with app.
+func PathAppSearchDirs(kind PathDirKind, app string) []string {
+	dirs := PathSearchDirs(kind)
+	for i := range dirs {
+		dirs[i] = pathAppJoin(kind, dirs[i], app)
+	}
+	return dirs
+}
+
+// PathFindAppFile returns the first existing file of filenames
+// in PathAppSearchDirs, filenames can be glob patterns, see FileFindGlob.
+// Example:
+//
+//	filename, found := PathFindAppFile(PathConfigDir, "myapp", "config.toml", "*.conf")
+func PathFindAppFile(kind PathDirKind, app string, filenames ...string) (filePath string, found bool) {
+	return FileFindGlob(PathAppSearchDirs(kind, app), filenames...)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Xelaj Software
+//
+// This file is a part of go-dry package.
+// See https://github.com/xelaj/go-dry/blob/master/LICENSE for details
+
+package dry
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathAppDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG defaults are tested on unix")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, env := range pathDirEnv {
+		t.Setenv(env, "")
+	}
+	t.Setenv("XDG_CACHE_HOME", "relative/is/ignored")
+
+	dir, err := PathAppDir(PathConfigDir, "app")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".config", "app"), dir)
+	dir, err = PathAppDir(PathCacheDir, "app")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".cache", "app"), dir)
+
+	stateHome := filepath.Join(home, "state")
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	dir, err = PathAppDirCreate(PathStateDir, "app")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(stateHome, "app"), dir)
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	_, err = PathUserDir(PathDirKind(99))
+	require.Error(t, err)
+}
+
+func TestPathRuntimeDirFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG defaults are tested on unix")
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	dir := filepath.Join(tmp, "runtime-"+strconv.Itoa(os.Getuid()))
+
+	result, err := PathUserDir(PathRuntimeDir)
+	require.NoError(t, err)
+	require.Equal(t, dir, result)
+
+	// a symlink planted by another user is rejected
+	require.NoError(t, os.Remove(dir))
+	target := filepath.Join(tmp, "target")
+	require.NoError(t, os.Mkdir(target, 0700))
+	require.NoError(t, os.Symlink(target, dir))
+	_, err = PathUserDir(PathRuntimeDir)
+	require.Error(t, err)
+
+	if os.Getuid() == 0 {
+		// so is a directory with the right mode but owned by another user
+		require.NoError(t, os.Remove(dir))
+		require.NoError(t, os.Mkdir(dir, 0700))
+		require.NoError(t, os.Chown(dir, 12345, 12345))
+		_, err = PathUserDir(PathRuntimeDir)
+		require.Error(t, err)
+	}
+}
+
+func TestPathFindAppFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG defaults are tested on unix")
+	}
+	userDir, systemDir1, systemDir2 := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv("XDG_CONFIG_DIRS", systemDir1+string(os.PathListSeparator)+"relative"+string(os.PathListSeparator)+systemDir2)
+	require.Equal(t, []string{userDir, systemDir1, systemDir2}, PathSearchDirs(PathConfigDir))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(systemDir2, "app"), 0755))
+	require.NoError(t, FileSetString(filepath.Join(systemDir2, "app", "app.conf"), "system"))
+	filename, found := PathFindAppFile(PathConfigDir, "app", "*.conf")
+	require.True(t, found)
+	require.Equal(t, filepath.Join(systemDir2, "app", "app.conf"), filename)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(userDir, "app"), 0755))
+	require.NoError(t, FileSetString(filepath.Join(userDir, "app", "app.conf"), "user"))
+	filename, found = PathFindAppFile(PathConfigDir, "app", "app.conf")
+	require.True(t, found)
+	require.Equal(t, filepath.Join(userDir, "app", "app.conf"), filename)
+
+	_, found = PathFindAppFile(PathConfigDir, "app", "missing.conf")
+	require.False(t, found)
+	t.Setenv("XDG_CONFIG_DIRS", "")
+	require.Equal(t, []string{userDir, "/etc/xdg"}, PathSearchDirs(PathConfigDir))
+}
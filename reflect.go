@@ -26,19 +26,19 @@ func ReflectSetStructFieldString(structPtr any, name, value string) error {
 	v = v.Elem()
 
 	if f := v.FieldByName(name); f.IsValid() {
-		if f.Kind() == reflect.String {
-			f.SetString(value)
-		} else {
-			_, err := fmt.Sscan(value, f.Addr().Interface())
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		return fmt.Errorf("%T has no struct field '%s'", v.Interface(), name)
+		return reflectSetFromString(f, value)
 	}
+	return fmt.Errorf("%T has no struct field '%s'", v.Interface(), name)
+}
 
-	return nil
+// reflectSetFromString sets the addressable value v by parsing str.
+func reflectSetFromString(v reflect.Value, str string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(str)
+		return nil
+	}
+	_, err := fmt.Sscan(str, v.Addr().Interface())
+	return err
 }
 
 // ReflectSetStructFieldsFromStringMap sets the fields of a struct
@@ -53,13 +53,8 @@ func ReflectSetStructFieldsFromStringMap(structPtr any, m map[string]string, err
 
 	for name, value := range m {
 		if f := v.FieldByName(name); f.IsValid() {
-			if f.Kind() == reflect.String {
-				f.SetString(value)
-			} else {
-				_, err := fmt.Sscan(value, f.Addr().Interface())
-				if err != nil {
-					return err
-				}
+			if err := reflectSetFromString(f, value); err != nil {
+				return err
 			}
 		} else if errOnMissingField {
 			return fmt.Errorf("%T has no struct field '%s'", v.Interface(), name)